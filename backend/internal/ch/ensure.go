@@ -10,6 +10,10 @@ import (
 	ch "github.com/ClickHouse/clickhouse-go/v2"
 )
 
+// freeEmailDomains are the free-mail providers is_free_email flags; the
+// schema.sql files mirror the list.
+const freeEmailDomains = `'gmail.com', 'googlemail.com', 'yahoo.com', 'yahoo.co.uk', 'yahoo.co.in', 'ymail.com', 'rocketmail.com', 'outlook.com', 'hotmail.com', 'hotmail.co.uk', 'live.com', 'msn.com', 'aol.com', 'icloud.com', 'me.com', 'mac.com', 'protonmail.com', 'proton.me', 'gmx.com', 'gmx.de', 'gmx.net', 'web.de', 'mail.com', 'zoho.com', 'yandex.com', 'yandex.ru', 'mail.ru', 'qq.com', '163.com', '126.com', 'rediffmail.com', 'fastmail.com', 'tutanota.com', 'hey.com'`
+
 func EnsureSchema(ctx context.Context, conn ch.Conn) error {
 	db := os.Getenv("CH_DATABASE")
 	if strings.TrimSpace(db) == "" {
@@ -32,8 +36,16 @@ func EnsureSchema(ctx context.Context, conn ch.Conn) error {
 			linkedin_company_page String,
 			country String,
 			state String,
+			-- E.164 when ingest could normalize the number, otherwise its digits
+			phone_e164 String DEFAULT replaceRegexpAll(phone, '[^0-9]+', ''),
+			company_phone_e164 String DEFAULT replaceRegexpAll(company_phone, '[^0-9]+', ''),
+			-- classified from position at ingest by the title rule table
+			seniority LowCardinality(String) DEFAULT '',
+			department LowCardinality(String) DEFAULT '',
 			file_id UInt64,
 			created_at DateTime DEFAULT now(),
+			-- uploadID<<32 | row number, or the row hash for rows ingested before ids existed
+			id UInt64 DEFAULT cityHash64(file_id, email, name, phone, linkedin, company, position),
 
 			name_lc String MATERIALIZED lowerUTF8(name),
 			email_lc String MATERIALIZED lowerUTF8(email),
@@ -47,6 +59,10 @@ func EnsureSchema(ctx context.Context, conn ch.Conn) error {
 			linkedin_company_page_lc String MATERIALIZED lowerUTF8(linkedin_company_page),
 			country_lc String MATERIALIZED lowerUTF8(country),
 			state_lc String MATERIALIZED lowerUTF8(state),
+			email_domain_lc String MATERIALIZED lowerUTF8(if(position(email, '@') > 0, substring(email, position(email, '@') + 1), '')),
+			is_free_email UInt8 MATERIALIZED email_domain_lc IN (`+freeEmailDomains+`),
+			-- tokenized by idx_search_text for the free-text q filter
+			search_text String MATERIALIZED lowerUTF8(concatWithSeparator(' ', name, email, company, position, domain, linkedin)),
 
 			INDEX idx_name name_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
 			INDEX idx_email email_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
@@ -54,10 +70,44 @@ func EnsureSchema(ctx context.Context, conn ch.Conn) error {
 			INDEX idx_position position_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
 			INDEX idx_domain domain_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
 			INDEX idx_linkedin linkedin_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
-			INDEX idx_state state_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1
+			INDEX idx_state state_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
+			INDEX idx_country country_lc TYPE bloom_filter(0.01) GRANULARITY 1,
+			INDEX idx_email_domain email_domain_lc TYPE bloom_filter(0.01) GRANULARITY 1,
+			INDEX idx_seniority seniority TYPE set(16) GRANULARITY 1,
+			INDEX idx_department department TYPE set(32) GRANULARITY 1,
+			INDEX idx_search_text search_text TYPE tokenbf_v1(32768, 3, 0) GRANULARITY 1,
+			INDEX idx_phone phone_e164 TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
+			INDEX idx_company_phone company_phone_e164 TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
+			INDEX idx_id id TYPE bloom_filter(0.001) GRANULARITY 1,
+			INDEX idx_file_id file_id TYPE minmax GRANULARITY 1
 		) ENGINE = MergeTree
 		ORDER BY (created_at, email_lc)
 		SETTINGS index_granularity = 8192;`, db),
+		// Upgrades for tables created before the statements above changed.
+		// New columns and indexes only cover parts written after they are
+		// added; backfills rewrites the older parts.
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_country country_lc TYPE bloom_filter(0.01) GRANULARITY 1;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD COLUMN IF NOT EXISTS id UInt64 DEFAULT cityHash64(file_id, email, name, phone, linkedin, company, position) AFTER created_at;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_id id TYPE bloom_filter(0.001) GRANULARITY 1;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD COLUMN IF NOT EXISTS phone_e164 String DEFAULT replaceRegexpAll(phone, '[^0-9]+', '') AFTER state;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD COLUMN IF NOT EXISTS company_phone_e164 String DEFAULT replaceRegexpAll(company_phone, '[^0-9]+', '') AFTER phone_e164;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_phone phone_e164 TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_company_phone company_phone_e164 TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD COLUMN IF NOT EXISTS email_domain_lc String MATERIALIZED lowerUTF8(if(position(email, '@') > 0, substring(email, position(email, '@') + 1), '')) AFTER state_lc;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD COLUMN IF NOT EXISTS is_free_email UInt8 MATERIALIZED email_domain_lc IN (`+freeEmailDomains+`) AFTER email_domain_lc;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_email_domain email_domain_lc TYPE bloom_filter(0.01) GRANULARITY 1;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD COLUMN IF NOT EXISTS seniority LowCardinality(String) DEFAULT '' AFTER company_phone_e164;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD COLUMN IF NOT EXISTS department LowCardinality(String) DEFAULT '' AFTER seniority;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_seniority seniority TYPE set(16) GRANULARITY 1;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_department department TYPE set(32) GRANULARITY 1;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD COLUMN IF NOT EXISTS search_text String MATERIALIZED lowerUTF8(concatWithSeparator(' ', name, email, company, position, domain, linkedin)) AFTER is_free_email;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_search_text search_text TYPE tokenbf_v1(32768, 3, 0) GRANULARITY 1;`, db),
+		fmt.Sprintf(`ALTER TABLE %s.contacts ADD INDEX IF NOT EXISTS idx_file_id file_id TYPE minmax GRANULARITY 1;`, db),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.schema_backfills (
+			name String,
+			applied_at DateTime DEFAULT now()
+		) ENGINE = MergeTree
+		ORDER BY name;`, db),
 	}
 	for _, s := range stmts {
 		scanner := bufio.NewScanner(strings.NewReader(s))
@@ -75,13 +125,77 @@ func EnsureSchema(ctx context.Context, conn ch.Conn) error {
 			return err
 		}
 	}
+	return runBackfills(ctx, conn, db)
+}
+
+// backfills are mutations writing columns and indexes into the parts that
+// predate them. Until then those parts compute the columns on every read and
+// are never skipped by the indexes, so id lookups, phone and q searches scan
+// them in full. Each rewrites the whole table, so it runs once, recorded in
+// schema_backfills, and ClickHouse applies it in the background. Statements
+// take the database name as %[1]s.
+var backfills = []struct {
+	name  string
+	stmts []string
+}{
+	{"materialize_search_columns", []string{
+		// DEFAULT columns are rewritten only where they still hold the default,
+		// keeping the ids and E.164 numbers ingest wrote
+		`ALTER TABLE %[1]s.contacts UPDATE id = cityHash64(file_id, email, name, phone, linkedin, company, position) WHERE id = cityHash64(file_id, email, name, phone, linkedin, company, position)`,
+		`ALTER TABLE %[1]s.contacts UPDATE phone_e164 = replaceRegexpAll(phone, '[^0-9]+', '') WHERE phone_e164 = replaceRegexpAll(phone, '[^0-9]+', '')`,
+		`ALTER TABLE %[1]s.contacts UPDATE company_phone_e164 = replaceRegexpAll(company_phone, '[^0-9]+', '') WHERE company_phone_e164 = replaceRegexpAll(company_phone, '[^0-9]+', '')`,
+		`ALTER TABLE %[1]s.contacts MATERIALIZE COLUMN email_domain_lc`,
+		`ALTER TABLE %[1]s.contacts MATERIALIZE COLUMN is_free_email`,
+		`ALTER TABLE %[1]s.contacts MATERIALIZE COLUMN search_text`,
+		`ALTER TABLE %[1]s.contacts MATERIALIZE INDEX idx_id`,
+		`ALTER TABLE %[1]s.contacts MATERIALIZE INDEX idx_phone`,
+		`ALTER TABLE %[1]s.contacts MATERIALIZE INDEX idx_company_phone`,
+		`ALTER TABLE %[1]s.contacts MATERIALIZE INDEX idx_email_domain`,
+		`ALTER TABLE %[1]s.contacts MATERIALIZE INDEX idx_search_text`,
+	}},
+}
+
+func runBackfills(ctx context.Context, conn ch.Conn, db string) error {
+	for _, b := range backfills {
+		var done uint64
+		if err := conn.QueryRow(ctx, fmt.Sprintf(`SELECT count() FROM %s.schema_backfills WHERE name = ?`, db), b.name).Scan(&done); err != nil {
+			return err
+		}
+		if done > 0 {
+			continue
+		}
+		for _, s := range b.stmts {
+			if err := conn.Exec(ctx, fmt.Sprintf(s, db)); err != nil {
+				return fmt.Errorf("backfill %s: %w", b.name, err)
+			}
+		}
+		if err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s.schema_backfills (name) VALUES (?)`, db), b.name); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// splitSemicolons is a bufio.SplitFunc that splits on ';' delimiters.
+// splitSemicolons is a bufio.SplitFunc that splits on ';' delimiters,
+// ignoring any inside -- comments and quoted string literals.
 func splitSemicolons(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	for i, b := range data {
-		if b == ';' {
+	inComment, inString := false, false
+	for i := 0; i < len(data); i++ {
+		switch {
+		case inComment:
+			inComment = data[i] != '\n'
+		case inString && data[i] == '\\':
+			i++ // escaped character
+		case inString:
+			inString = data[i] != '\''
+		case data[i] == '\'':
+			inString = true
+		case data[i] == '-' && i+1 == len(data) && !atEOF:
+			return 0, nil, nil // may start a comment; need more data
+		case data[i] == '-' && i+1 < len(data) && data[i+1] == '-':
+			inComment = true
+			i++
+		case data[i] == ';':
 			return i + 1, data[:i], nil
 		}
 	}
@@ -0,0 +1,44 @@
+package ch
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSemicolons(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}},
+		{"several", "SELECT 1; SELECT 2;", []string{"SELECT 1", " SELECT 2"}},
+		{"comment", "CREATE TABLE t (\n\tid UInt64 -- a; b\n);\nSELECT 1", []string{"CREATE TABLE t (\n\tid UInt64 -- a; b\n)", "\nSELECT 1"}},
+		{"comment at end", "SELECT 1 -- done;", []string{"SELECT 1 -- done;"}},
+		{"single dash", "SELECT 1-2; SELECT 3", []string{"SELECT 1-2", " SELECT 3"}},
+		{"string", "SELECT 'a;b'; SELECT 2", []string{"SELECT 'a;b'", " SELECT 2"}},
+		{"escaped quote", `SELECT 'it\'s; fine'; SELECT 2`, []string{`SELECT 'it\'s; fine'`, " SELECT 2"}},
+		{"doubled quote", "SELECT 'it''s; fine'; SELECT 2", []string{"SELECT 'it''s; fine'", " SELECT 2"}},
+		{"dashes in string", "SELECT '--'; SELECT 2", []string{"SELECT '--'", " SELECT 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := bufio.NewScanner(strings.NewReader(tt.in))
+			// a tiny initial buffer makes the split function ask for more data
+			sc.Buffer(make([]byte, 1), 1<<20)
+			sc.Split(splitSemicolons)
+			var got []string
+			for sc.Scan() {
+				got = append(got, sc.Text())
+			}
+			if err := sc.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,8 +15,16 @@ CREATE TABLE IF NOT EXISTS finpro.contacts (
 	linkedin_company_page String,
 	country String,
 	state String,
+	-- E.164 when ingest could normalize the number, otherwise its digits
+	phone_e164 String DEFAULT replaceRegexpAll(phone, '[^0-9]+', ''),
+	company_phone_e164 String DEFAULT replaceRegexpAll(company_phone, '[^0-9]+', ''),
+	-- classified from position at ingest by the title rule table
+	seniority LowCardinality(String) DEFAULT '',
+	department LowCardinality(String) DEFAULT '',
 	file_id UInt64,
 	created_at DateTime DEFAULT now(),
+	-- uploadID<<32 | row number, or the row hash for rows ingested before ids existed
+	id UInt64 DEFAULT cityHash64(file_id, email, name, phone, linkedin, company, position),
 
 	name_lc String MATERIALIZED lowerUTF8(name),
 	email_lc String MATERIALIZED lowerUTF8(email),
@@ -30,6 +38,11 @@ CREATE TABLE IF NOT EXISTS finpro.contacts (
 	linkedin_company_page_lc String MATERIALIZED lowerUTF8(linkedin_company_page),
 	country_lc String MATERIALIZED lowerUTF8(country),
 	state_lc String MATERIALIZED lowerUTF8(state),
+	email_domain_lc String MATERIALIZED lowerUTF8(if(position(email, '@') > 0, substring(email, position(email, '@') + 1), '')),
+	-- free-mail providers; keep in sync with freeEmailDomains in internal/ch/ensure.go
+	is_free_email UInt8 MATERIALIZED email_domain_lc IN ('gmail.com', 'googlemail.com', 'yahoo.com', 'yahoo.co.uk', 'yahoo.co.in', 'ymail.com', 'rocketmail.com', 'outlook.com', 'hotmail.com', 'hotmail.co.uk', 'live.com', 'msn.com', 'aol.com', 'icloud.com', 'me.com', 'mac.com', 'protonmail.com', 'proton.me', 'gmx.com', 'gmx.de', 'gmx.net', 'web.de', 'mail.com', 'zoho.com', 'yandex.com', 'yandex.ru', 'mail.ru', 'qq.com', '163.com', '126.com', 'rediffmail.com', 'fastmail.com', 'tutanota.com', 'hey.com'),
+	-- tokenized by idx_search_text for the free-text q filter
+	search_text String MATERIALIZED lowerUTF8(concatWithSeparator(' ', name, email, company, position, domain, linkedin)),
 
 	INDEX idx_name name_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
 	INDEX idx_email email_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
@@ -37,7 +50,16 @@ CREATE TABLE IF NOT EXISTS finpro.contacts (
 	INDEX idx_position position_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
 	INDEX idx_domain domain_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
 	INDEX idx_linkedin linkedin_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
-	INDEX idx_state state_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1
+	INDEX idx_state state_lc TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
+	INDEX idx_country country_lc TYPE bloom_filter(0.01) GRANULARITY 1,
+	INDEX idx_email_domain email_domain_lc TYPE bloom_filter(0.01) GRANULARITY 1,
+	INDEX idx_seniority seniority TYPE set(16) GRANULARITY 1,
+	INDEX idx_department department TYPE set(32) GRANULARITY 1,
+	INDEX idx_search_text search_text TYPE tokenbf_v1(32768, 3, 0) GRANULARITY 1,
+	INDEX idx_phone phone_e164 TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
+	INDEX idx_company_phone company_phone_e164 TYPE ngrambf_v1(3, 256, 2, 0) GRANULARITY 1,
+	INDEX idx_id id TYPE bloom_filter(0.001) GRANULARITY 1,
+	INDEX idx_file_id file_id TYPE minmax GRANULARITY 1
 ) ENGINE = MergeTree
 ORDER BY (created_at, email_lc)
 SETTINGS index_granularity = 8192;
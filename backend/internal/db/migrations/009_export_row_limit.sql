@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS export_row_limit INTEGER NOT NULL DEFAULT 10000;
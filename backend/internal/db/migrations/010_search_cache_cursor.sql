@@ -0,0 +1 @@
+ALTER TABLE user_device_search_cache ADD COLUMN IF NOT EXISTS next_cursor TEXT;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS user_saved_searches (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	params JSONB NOT NULL,
+	last_run_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (user_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS uss_user_idx ON user_saved_searches(user_id, updated_at DESC);
+
+DROP TRIGGER IF EXISTS trg_uss_updated_at ON user_saved_searches;
+CREATE TRIGGER trg_uss_updated_at
+BEFORE UPDATE ON user_saved_searches
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
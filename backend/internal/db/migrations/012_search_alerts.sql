@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS user_search_alerts (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	params JSONB NOT NULL,
+	is_active BOOLEAN NOT NULL DEFAULT true,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS usa_user_idx ON user_search_alerts(user_id);
+CREATE INDEX IF NOT EXISTS usa_active_idx ON user_search_alerts(is_active);
+
+DROP TRIGGER IF EXISTS trg_usa_updated_at ON user_search_alerts;
+CREATE TRIGGER trg_usa_updated_at
+BEFORE UPDATE ON user_search_alerts
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at();
+
+-- one row per alert that matched contacts in a finished upload
+CREATE TABLE IF NOT EXISTS user_alert_notifications (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	alert_id UUID NOT NULL REFERENCES user_search_alerts(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	upload_id BIGINT NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+	match_count BIGINT NOT NULL,
+	emailed_at TIMESTAMPTZ,
+	read_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (alert_id, upload_id)
+);
+
+CREATE INDEX IF NOT EXISTS uan_user_created_idx ON user_alert_notifications(user_id, created_at DESC);
@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reveal_credits INTEGER NOT NULL DEFAULT 0;
+
+-- contacts a user has paid to see unmasked; contact_ref is "<created_at>.<row hash>"
+CREATE TABLE IF NOT EXISTS user_contact_reveals (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	contact_ref TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (user_id, contact_ref)
+);
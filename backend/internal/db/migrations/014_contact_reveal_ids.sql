@@ -0,0 +1,11 @@
+-- Reveals were keyed by "<created_at>.<row hash>" before contacts had ids.
+-- Rows ingested before then take their row hash as id, so keep only the hash.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'user_contact_reveals' AND column_name = 'contact_ref') THEN
+		DELETE FROM user_contact_reveals r USING user_contact_reveals d
+		WHERE r.user_id = d.user_id AND split_part(r.contact_ref, '.', 2) = split_part(d.contact_ref, '.', 2) AND r.contact_ref > d.contact_ref;
+		UPDATE user_contact_reveals SET contact_ref = split_part(contact_ref, '.', 2) WHERE contact_ref LIKE '%.%';
+		ALTER TABLE user_contact_reveals RENAME COLUMN contact_ref TO contact_id;
+	END IF;
+END$$;
@@ -0,0 +1,4 @@
+-- query_key is the search's filters without paging, set on the log of a
+-- run's first page so repeat runs of a query can be found
+ALTER TABLE user_search_logs ADD COLUMN IF NOT EXISTS query_key TEXT;
+CREATE INDEX IF NOT EXISTS usl_query_key_idx ON user_search_logs(user_id, query_key, created_at DESC);
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type searchAlertInput struct {
+	Name     *string        `json:"name"`
+	Params   *searchRequest `json:"params"`
+	IsActive *bool          `json:"is_active"`
+}
+
+func (h *Handlers) ListSearchAlerts(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	rows, err := h.pg.Query(c, `SELECT id::text, name, params::text, is_active, created_at, updated_at FROM user_search_alerts WHERE user_id=$1 ORDER BY created_at DESC LIMIT 200`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	list := []gin.H{}
+	for rows.Next() {
+		var id, name, params string
+		var isActive bool
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&id, &name, &params, &isActive, &createdAt, &updatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list = append(list, gin.H{"id": id, "name": name, "params": jsonText(params), "is_active": isActive, "created_at": createdAt, "updated_at": updatedAt})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": list})
+}
+
+func (h *Handlers) CreateSearchAlert(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	var in searchAlertInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if in.Name == nil || strings.TrimSpace(*in.Name) == "" || in.Params == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and params required"})
+		return
+	}
+	if err := validateSearchRequest(*in.Params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	isActive := true
+	if in.IsActive != nil {
+		isActive = *in.IsActive
+	}
+	var id string
+	err := h.pg.QueryRow(c, `INSERT INTO user_search_alerts (user_id, name, params, is_active) VALUES ($1,$2,$3,$4) RETURNING id::text`,
+		userID, strings.TrimSpace(*in.Name), toJSON(savedParams(*in.Params)), isActive).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create alert"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (h *Handlers) UpdateSearchAlert(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var in searchAlertInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	// Build dynamic UPDATE
+	set := []string{}
+	args := []any{}
+	idx := 1
+	if in.Name != nil {
+		if strings.TrimSpace(*in.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+		set = append(set, "name = $"+itoa(idx))
+		args = append(args, strings.TrimSpace(*in.Name))
+		idx++
+	}
+	if in.Params != nil {
+		if err := validateSearchRequest(*in.Params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set = append(set, "params = $"+itoa(idx))
+		args = append(args, toJSON(savedParams(*in.Params)))
+		idx++
+	}
+	if in.IsActive != nil {
+		set = append(set, "is_active = $"+itoa(idx))
+		args = append(args, *in.IsActive)
+		idx++
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+	args = append(args, id, userID)
+	query := "UPDATE user_search_alerts SET " + strings.Join(set, ", ") + " WHERE id = $" + itoa(idx) + " AND user_id = $" + itoa(idx+1)
+	res, err := h.pg.Exec(c, query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (h *Handlers) DeleteSearchAlert(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	res, err := h.pg.Exec(c, `DELETE FROM user_search_alerts WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete alert"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ListAlertNotifications returns the user's most recent alert matches;
+// ?unread=true limits it to ones not yet marked read.
+func (h *Handlers) ListAlertNotifications(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	unreadOnly := c.Query("unread") == "true"
+	rows, err := h.pg.Query(c, `SELECT n.id::text, n.alert_id::text, a.name, a.params::text, n.upload_id, u.original_filename, n.match_count, n.read_at, n.created_at
+		FROM user_alert_notifications n
+		JOIN user_search_alerts a ON a.id = n.alert_id
+		JOIN uploads u ON u.id = n.upload_id
+		WHERE n.user_id=$1 AND ($2 = false OR n.read_at IS NULL)
+		ORDER BY n.created_at DESC
+		LIMIT 100`, userID, unreadOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	list := []gin.H{}
+	for rows.Next() {
+		var id, alertID, alertName, params, filename string
+		var uploadID, matches int64
+		var readAt *time.Time
+		var createdAt time.Time
+		if err := rows.Scan(&id, &alertID, &alertName, &params, &uploadID, &filename, &matches, &readAt, &createdAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list = append(list, gin.H{"id": id, "alert_id": alertID, "alert_name": alertName, "params": jsonText(params), "upload_id": uploadID, "upload_filename": filename, "match_count": matches, "read_at": readAt, "created_at": createdAt})
+	}
+	var unread int
+	_ = h.pg.QueryRow(c, `SELECT count(*) FROM user_alert_notifications WHERE user_id=$1 AND read_at IS NULL`, userID).Scan(&unread)
+	c.JSON(http.StatusOK, gin.H{"items": list, "unread_count": unread})
+}
+
+func (h *Handlers) MarkAlertNotificationRead(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	res, err := h.pg.Exec(c, `UPDATE user_alert_notifications SET read_at=COALESCE(read_at, now()) WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// evaluateAlerts runs every active alert against the contacts of a finished
+// upload and notifies owners of alerts that matched, in-app and by email.
+// Alert evaluation does not count against anyone's search quota.
+func (h *Handlers) evaluateAlerts(ctx context.Context, uploadID int64) {
+	type alert struct {
+		id, userID, name, email string
+		params                  []byte
+	}
+	rows, err := h.pg.Query(ctx, `SELECT a.id::text, a.user_id::text, a.name, a.params, u.email
+		FROM user_search_alerts a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.is_active AND u.is_active`)
+	if err != nil {
+		fmt.Println("alerts error:", err)
+		return
+	}
+	var alerts []alert
+	for rows.Next() {
+		var a alert
+		if err := rows.Scan(&a.id, &a.userID, &a.name, &a.params, &a.email); err != nil {
+			rows.Close()
+			fmt.Println("alerts error:", err)
+			return
+		}
+		alerts = append(alerts, a)
+	}
+	rows.Close()
+
+	link := getenv("PUBLIC_BASE_URL", "http://localhost:8080")
+	for _, a := range alerts {
+		var req searchRequest
+		if err := json.Unmarshal(a.params, &req); err != nil {
+			continue
+		}
+		where, args, err := compileSearch(req)
+		if err != nil {
+			continue
+		}
+		where = andWhere("file_id = ?", where)
+		args = append([]any{uploadID}, args...)
+		// idx_file_id narrows this to the upload's granules
+		var matches uint64
+		countCtx, countCancel := context.WithTimeout(ctx, 30*time.Second)
+		err = h.ck.QueryRow(countCtx, `SELECT count() FROM contacts WHERE `+where, args...).Scan(&matches)
+		countCancel()
+		if err != nil {
+			fmt.Printf("alert %s error: %v\n", a.id, err)
+			continue
+		}
+		if matches == 0 {
+			continue
+		}
+		var notificationID string
+		err = h.pg.QueryRow(ctx, `INSERT INTO user_alert_notifications (alert_id, user_id, upload_id, match_count) VALUES ($1,$2,$3,$4)
+			ON CONFLICT (alert_id, upload_id) DO NOTHING
+			RETURNING id::text`, a.id, a.userID, uploadID, int64(matches)).Scan(&notificationID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue // already notified for this upload
+		}
+		if err != nil {
+			fmt.Printf("alert %s error: %v\n", a.id, err)
+			continue
+		}
+		if err := sendAlertEmail(a.email, a.name, int64(matches), link); err != nil {
+			log.Printf("sendAlertEmail error: %v", err)
+			continue
+		}
+		_, _ = h.pg.Exec(ctx, `UPDATE user_alert_notifications SET emailed_at=now() WHERE id=$1`, notificationID)
+	}
+}
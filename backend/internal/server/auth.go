@@ -193,6 +193,8 @@ type AdminCreateUserInput struct {
 	Role             string `json:"role"`
 	Name             string `json:"name"`
 	DailySearchLimit *int   `json:"dailySearchLimit"`
+	ExportRowLimit   *int   `json:"exportRowLimit"`
+	RevealCredits    *int   `json:"revealCredits"`
 	PhoneNumber      string `json:"phone_number"`
 	IsActive         *bool  `json:"is_active"`
 }
@@ -227,11 +229,19 @@ func (h *Handlers) AdminCreateUser(c *gin.Context) {
 	if in.DailySearchLimit != nil {
 		limit = *in.DailySearchLimit
 	}
+	exportLimit := 10000
+	if in.ExportRowLimit != nil {
+		exportLimit = *in.ExportRowLimit
+	}
+	revealCredits := 0
+	if in.RevealCredits != nil {
+		revealCredits = *in.RevealCredits
+	}
 	isActive := true
 	if in.IsActive != nil {
 		isActive = *in.IsActive
 	}
-	err := h.pg.QueryRow(c, `INSERT INTO users (email, password_hash, role, name, phone_number, is_active, daily_search_limit) VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id`, in.Email, string(hash), in.Role, in.Name, in.PhoneNumber, isActive, limit).Scan(&id)
+	err := h.pg.QueryRow(c, `INSERT INTO users (email, password_hash, role, name, phone_number, is_active, daily_search_limit, export_row_limit, reveal_credits) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING id`, in.Email, string(hash), in.Role, in.Name, in.PhoneNumber, isActive, limit, exportLimit, revealCredits).Scan(&id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "could not create user"})
 		return
@@ -252,12 +262,14 @@ type AdminUpdateUserInput struct {
 	Name             *string `json:"name"`
 	Role             *string `json:"role"`
 	DailySearchLimit *int    `json:"dailySearchLimit"`
+	ExportRowLimit   *int    `json:"exportRowLimit"`
+	RevealCredits    *int    `json:"revealCredits"`
 	IsActive         *bool   `json:"is_active"`
 	Password         *string `json:"password"`
 }
 
 func (h *Handlers) AdminListUsers(c *gin.Context) {
-	rows, err := h.pg.Query(c, `SELECT id::text, email, role, name, daily_search_limit, is_active, created_at FROM users ORDER BY created_at DESC LIMIT 200`)
+	rows, err := h.pg.Query(c, `SELECT id::text, email, role, name, daily_search_limit, export_row_limit, reveal_credits, is_active, created_at FROM users ORDER BY created_at DESC LIMIT 200`)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -266,11 +278,11 @@ func (h *Handlers) AdminListUsers(c *gin.Context) {
 	out := []gin.H{}
 	for rows.Next() {
 		var id, email, role, name string
-		var limit int
+		var limit, exportLimit, revealCredits int
 		var isActive bool
 		var createdAt time.Time
-		_ = rows.Scan(&id, &email, &role, &name, &limit, &isActive, &createdAt)
-		out = append(out, gin.H{"id": id, "email": email, "role": role, "name": name, "dailySearchLimit": limit, "is_active": isActive, "created_at": createdAt})
+		_ = rows.Scan(&id, &email, &role, &name, &limit, &exportLimit, &revealCredits, &isActive, &createdAt)
+		out = append(out, gin.H{"id": id, "email": email, "role": role, "name": name, "dailySearchLimit": limit, "exportRowLimit": exportLimit, "revealCredits": revealCredits, "is_active": isActive, "created_at": createdAt})
 	}
 	c.JSON(http.StatusOK, gin.H{"users": out})
 }
@@ -310,6 +322,16 @@ func (h *Handlers) AdminUpdateUser(c *gin.Context) {
 		args = append(args, *in.DailySearchLimit)
 		idx++
 	}
+	if in.ExportRowLimit != nil {
+		set = append(set, "export_row_limit = $"+itoa(idx))
+		args = append(args, *in.ExportRowLimit)
+		idx++
+	}
+	if in.RevealCredits != nil {
+		set = append(set, "reveal_credits = $"+itoa(idx))
+		args = append(args, *in.RevealCredits)
+		idx++
+	}
 	if in.IsActive != nil {
 		set = append(set, "is_active = $"+itoa(idx))
 		args = append(args, *in.IsActive)
@@ -471,8 +493,8 @@ func (h *Handlers) Me(c *gin.Context) {
 	email := fmt.Sprintf("%v", emailAny)
 	role := fmt.Sprintf("%v", roleAny)
 	var name *string
-	var dailyLimit int
-	if err := h.pg.QueryRow(c, `SELECT name, daily_search_limit FROM users WHERE id = $1`, userID).Scan(&name, &dailyLimit); err != nil {
+	var dailyLimit, exportLimit, revealCredits int
+	if err := h.pg.QueryRow(c, `SELECT name, daily_search_limit, export_row_limit, reveal_credits FROM users WHERE id = $1`, userID).Scan(&name, &dailyLimit, &exportLimit, &revealCredits); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load profile"})
 		return
 	}
@@ -488,8 +510,10 @@ func (h *Handlers) Me(c *gin.Context) {
 			}
 			return ""
 		}(),
-		"searches_today": used,
-		"daily_limit":    dailyLimit,
+		"searches_today":   used,
+		"daily_limit":      dailyLimit,
+		"export_row_limit": exportLimit,
+		"reveal_credits":   revealCredits,
 	})
 }
 
@@ -540,7 +564,8 @@ func (h *Handlers) UserLastSearch(c *gin.Context) {
 	var total int64
 	var normKey string
 	var paramsJSON []byte
-	err := h.pg.QueryRow(c, `SELECT snapshot, total_results, normalized_key, COALESCE(params::text,'') FROM user_device_search_cache WHERE user_id=$1 AND device_fingerprint=$2`, userID, finger).Scan(&snap, &total, &normKey, &paramsJSON)
+	var nextCursor string
+	err := h.pg.QueryRow(c, `SELECT snapshot, total_results, normalized_key, COALESCE(params::text,''), COALESCE(next_cursor,'') FROM user_device_search_cache WHERE user_id=$1 AND device_fingerprint=$2`, userID, finger).Scan(&snap, &total, &normKey, &paramsJSON, &nextCursor)
 	if err != nil || snap == nil {
 		c.JSON(http.StatusOK, gin.H{"rows": []gin.H{}, "total": 0, "params": gin.H{}})
 		return
@@ -552,7 +577,9 @@ func (h *Handlers) UserLastSearch(c *gin.Context) {
 	} else {
 		_ = h.pg.QueryRow(c, `SELECT params::text FROM user_search_logs WHERE user_id=$1 AND normalized_key=$2 ORDER BY created_at DESC LIMIT 1`, userID, normKey).Scan(&paramsText)
 	}
-	c.JSON(http.StatusOK, gin.H{"rows": jsonRaw(snap), "total": total, "params": jsonText(paramsText)})
+	var rows []contactRow
+	_ = json.Unmarshal(snap, &rows)
+	c.JSON(http.StatusOK, gin.H{"rows": h.maskRows(c, rows), "total": total, "params": jsonText(paramsText), "nextCursor": nextCursor})
 }
 
 // helpers to embed raw json safely
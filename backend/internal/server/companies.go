@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// normDomain reduces a domain or website URL to the form stored in
+// domain_lc, e.g. "https://www.Acme.com/about" becomes "acme.com".
+func normDomain(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "http://")
+	s = strings.TrimPrefix(s, "https://")
+	s = strings.TrimPrefix(s, "www.")
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// GetCompany aggregates every contact at a domain into a company profile:
+// the most common spelling of each company field, how many distinct people
+// are known there and their top positions and countries. Like SearchFacets
+// it is refused once the daily quota is used up but is not charged.
+func (h *Handlers) GetCompany(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "auth required"})
+		return
+	}
+	userID := userIDAny.(string)
+
+	domain := normDomain(c.Param("domain"))
+	if domain == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "domain required"})
+		return
+	}
+	top, ok := topParam(c)
+	if !ok {
+		return
+	}
+
+	exceeded, err := h.quotaExceeded(c.Request.Context(), userID, istUsageDate())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed quota"})
+		return
+	}
+	if exceeded {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "daily search limit reached"})
+		return
+	}
+
+	ckCtx, ckCancel := context.WithTimeout(c.Request.Context(), requestTimeout(c, 20*time.Second))
+	defer ckCancel()
+
+	where := "domain_lc = ?"
+	args := []any{domain}
+	var (
+		wg                                 sync.WaitGroup
+		mu                                 sync.Mutex
+		firstErr                           error
+		contacts, headcount                uint64
+		name, website, linkedinPage, phone string
+		positions, countries               []facetValue
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		// headcount counts people once across duplicate rows, as dedupe does
+		err := h.ck.QueryRow(ckCtx, `SELECT
+				count(),
+				uniqExact(`+personKeyExpr+`),
+				topKIf(1)(company, company != '')[1],
+				topKIf(1)(website, website != '')[1],
+				topKIf(1)(linkedin_company_page, linkedin_company_page != '')[1],
+				topKIf(1)(company_phone, company_phone != '')[1]
+			FROM contacts
+			WHERE `+where, args...).Scan(&contacts, &headcount, &name, &website, &linkedinPage, &phone)
+		if err != nil {
+			fail(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		v, err := h.topValues(ckCtx, "contacts", "position", "position_lc", where, args, top)
+		if err != nil {
+			fail(err)
+			return
+		}
+		positions = v
+	}()
+	go func() {
+		defer wg.Done()
+		v, err := h.topValues(ckCtx, "contacts", "country", "country_lc", where, args, top)
+		if err != nil {
+			fail(err)
+			return
+		}
+		countries = v
+	}()
+	wg.Wait()
+
+	if firstErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": firstErr.Error()})
+		return
+	}
+	if contacts == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	// company phones come from contact rows, so they are masked like them
+	if role, _ := c.Get("role"); role != "ADMIN" {
+		phone = maskPhone(phone)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"domain":              domain,
+		"name":                name,
+		"website":             website,
+		"linkedinCompanyPage": linkedinPage,
+		"companyPhone":        phone,
+		"contacts":            contacts,
+		"headcount":           headcount,
+		"topPositions":        positions,
+		"topCountries":        countries,
+	})
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetContact returns one contact by id together with the upload it was
+// ingested from. Email and phones are masked unless revealed, as in Search.
+// Ids are sequential within an upload, so each lookup that finds a contact
+// costs one search from the daily quota to keep the table from being walked.
+func (h *Handlers) GetContact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	userID := c.GetString("user_id")
+	usageDate := istUsageDate()
+	exceeded, err := h.quotaExceeded(c.Request.Context(), userID, usageDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed quota"})
+		return
+	}
+	if exceeded {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "daily search limit reached"})
+		return
+	}
+
+	ckCtx, ckCancel := context.WithTimeout(c.Request.Context(), requestTimeout(c, 20*time.Second))
+	defer ckCancel()
+	rows, err := h.ck.Query(ckCtx, fmt.Sprintf(`SELECT %s, created_at FROM contacts WHERE id = ? LIMIT 1`, contactColumns), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var ingestedAt time.Time
+	r, err := scanContact(rows, &ingestedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.chargeSearch(c.Request.Context(), userID, usageDate)
+
+	var (
+		filename, status string
+		rowCount         sql.NullInt64
+		uploadedAt       time.Time
+	)
+	upload := gin.H{"id": r.FileID}
+	err = h.pg.QueryRow(c.Request.Context(), `SELECT original_filename, status, row_count, created_at FROM uploads WHERE id = $1`, int64(r.FileID)).Scan(&filename, &status, &rowCount, &uploadedAt)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		// the upload record was deleted; the contact itself is still valid
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	default:
+		r.SourceFile = filename
+		upload["original_filename"] = filename
+		upload["status"] = status
+		upload["row_count"] = nullableInt(rowCount)
+		upload["created_at"] = uploadedAt
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"contact":     h.maskRows(c, []contactRow{r})[0],
+		"ingested_at": ingestedAt,
+		"upload":      upload,
+	})
+}
+
+// sourceFiles returns the original filenames of the given uploads.
+func (h *Handlers) sourceFiles(ctx context.Context, ids []int64) (map[uint64]string, error) {
+	rows, err := h.pg.Query(ctx, `SELECT id, original_filename FROM uploads WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[uint64]string, len(ids))
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		out[uint64(id)] = name
+	}
+	return out, rows.Err()
+}
+
+// attachSourceFiles sets SourceFile on rows; filenames that can't be loaded
+// are left empty.
+func (h *Handlers) attachSourceFiles(ctx context.Context, rows []contactRow) {
+	seen := map[uint64]bool{}
+	var ids []int64
+	for _, r := range rows {
+		if !seen[r.FileID] {
+			seen[r.FileID] = true
+			ids = append(ids, int64(r.FileID))
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	names, err := h.sourceFiles(ctx, ids)
+	if err != nil {
+		return
+	}
+	for i := range rows {
+		rows[i].SourceFile = names[rows[i].FileID]
+	}
+}
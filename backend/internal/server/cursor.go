@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// searchCursor is the position after the last row of a page, holding that
+// row's value for each ORDER BY term. It is handed to clients as an opaque
+// base64 string.
+type searchCursor struct {
+	Sort      string   `json:"s,omitempty"` // sortSignature the cursor was produced under
+	Keys      []string `json:"k,omitempty"` // text sort key values, in order
+	Score     uint64   `json:"r,omitempty"` // relevance, when sorted on
+	CreatedAt uint32   `json:"t"`
+	ID        uint64   `json:"i"`
+	// Since is the sinceLastRun cutoff in Unix seconds, resolved on the
+	// first page so later pages keep it; zero when there is none.
+	Since int64 `json:"n,omitempty"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// newCursor starts the cursor of a page sorted by sortSig and cut off at
+// since, for cursorDest to fill.
+func newCursor(sortSig string, since *time.Time) searchCursor {
+	sc := searchCursor{Sort: sortSig}
+	if since != nil {
+		sc.Since = since.Unix()
+	}
+	return sc
+}
+
+func (sc searchCursor) encode() string {
+	b, _ := json.Marshal(sc)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a cursor and checks it was produced under the same
+// sort as the request continuing from it.
+func decodeCursor(s string, order []orderKey, sortSig string) (searchCursor, error) {
+	var sc searchCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return sc, errInvalidCursor
+	}
+	if err := json.Unmarshal(b, &sc); err != nil || sc.CreatedAt == 0 || sc.ID == 0 {
+		return sc, errInvalidCursor
+	}
+	if sc.Sort != sortSig || len(sc.Keys) != countKind(order, keyText) {
+		return sc, errInvalidCursor
+	}
+	return sc, nil
+}
+
+func countKind(order []orderKey, kind int) int {
+	n := 0
+	for _, k := range order {
+		if k.kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// cursorDest returns scan destinations for the columns orderSelect adds,
+// filling sc as rows are scanned.
+func cursorDest(order []orderKey, sc *searchCursor) []any {
+	sc.Keys = make([]string, countKind(order, keyText))
+	dest := make([]any, 0, len(order))
+	ti := 0
+	for _, k := range order {
+		switch k.kind {
+		case keyText:
+			dest = append(dest, &sc.Keys[ti])
+			ti++
+		case keyTime:
+			dest = append(dest, &sc.CreatedAt)
+		case keyID:
+			dest = append(dest, &sc.ID)
+		case keyScore:
+			dest = append(dest, &sc.Score)
+		}
+	}
+	return dest
+}
+
+// cursorWhere restricts a scan in the given order to rows after the cursor:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., flipping the comparison for
+// descending keys. When created_at leads the order ClickHouse can still skip
+// granules by primary key.
+func cursorWhere(order []orderKey, sc searchCursor) (string, []any) {
+	var (
+		ors, eqs     []string
+		args, eqArgs []any
+		ti           int
+	)
+	for _, k := range order {
+		var v any
+		ph := "?"
+		switch k.kind {
+		case keyText:
+			v = sc.Keys[ti]
+			ti++
+		case keyTime:
+			v = sc.CreatedAt
+			ph = "toDateTime(?)"
+		case keyID:
+			v = sc.ID
+		case keyScore:
+			v = sc.Score
+		}
+		op := " > "
+		if k.desc {
+			op = " < "
+		}
+		term := append(append([]string{}, eqs...), k.expr+op+ph)
+		ors = append(ors, "("+strings.Join(term, " AND ")+")")
+		args = append(append(args, eqArgs...), v)
+		eqs = append(eqs, k.expr+" = "+ph)
+		eqArgs = append(eqArgs, v)
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// personKeyExpr identifies one person across uploads: their normalized
+// email, or LinkedIn URL when the email is empty. Rows with neither are
+// kept apart by id.
+const personKeyExpr = `if(email_lc != '', email_lc, if(linkedin_lc != '', linkedin_lc, toString(id)))`
+
+// mergedFields are the contact columns a deduplicated search merges, each
+// taking its most recent non-empty value.
+var mergedFields = []string{"name", "email", "phone", "linkedin", "position", "company", "company_phone", "website", "domain", "facebook", "twitter", "linkedin_company_page", "country", "state", "seniority", "department", "phone_e164", "company_phone_e164"}
+
+// dedupedContacts is a subquery with one merged row per person among the
+// contacts matching where. Columns keep their table names, including the
+// _lc copies sortColumns, relevanceExpr and facets use, so the usual select
+// list, ORDER BY and cursor conditions apply to it unchanged. Aggregates are
+// aliased d_* and renamed in an outer layer because ClickHouse substitutes an
+// alias that shadows a column into the aggregates reading that column.
+func dedupedContacts(where string) string {
+	var agg, cols []string
+	for _, f := range mergedFields {
+		agg = append(agg, fmt.Sprintf("argMaxIf(%s, created_at, %s != '') AS d_%s", f, f, f))
+		cols = append(cols, fmt.Sprintf("d_%s AS %s", f, f))
+	}
+	for _, f := range []string{"name", "email", "linkedin", "position", "company", "website", "domain", "facebook", "linkedin_company_page", "country", "state"} {
+		cols = append(cols, fmt.Sprintf("lowerUTF8(d_%s) AS %s_lc", f, f))
+	}
+	agg = append(agg, "max(created_at) AS d_created_at", "argMax(id, created_at) AS d_id", "argMax(file_id, created_at) AS d_file_id")
+	cols = append(cols, "d_created_at AS created_at", "d_id AS id", "d_file_id AS file_id")
+	return fmt.Sprintf(`(SELECT %s FROM (SELECT %s
+		FROM contacts
+		WHERE %s
+		GROUP BY %s))`, strings.Join(cols, ", "), strings.Join(agg, ", "), where, personKeyExpr)
+}
+
+// contactSource returns what a search selects contacts from and the
+// condition left to apply to it: the contacts table filtered by where, or
+// with dedupe the merged people matching where, which need no further
+// filter.
+func contactSource(dedupe bool, where string) (from, outerWhere string) {
+	if dedupe {
+		return dedupedContacts(where), "1"
+	}
+	return "contacts", where
+}
+
+// countQuery counts matches of where: rows, or distinct people with dedupe.
+func countQuery(dedupe bool, where string) string {
+	if dedupe {
+		return fmt.Sprintf(`SELECT uniqExact(%s) FROM contacts WHERE %s`, personKeyExpr, where)
+	}
+	return fmt.Sprintf(`SELECT count() FROM contacts WHERE %s`, where)
+}
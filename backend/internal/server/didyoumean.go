@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// didYouMeanFields are the fields alternatives are suggested for, mapped to
+// the column and its lowercased copy. Each lowercased column has an ngram
+// bloom filter index (idx_name, idx_company, idx_domain).
+var didYouMeanFields = []struct {
+	field string
+	cols  [2]string
+}{
+	{"name", [2]string{"name", "name_lc"}},
+	{"company", [2]string{"company", "company_lc"}},
+	{"domain", [2]string{"domain", "domain_lc"}},
+}
+
+const (
+	// maxDidYouMean is how many alternatives are returned per field.
+	maxDidYouMean = 5
+	// didYouMeanDistance is the largest ngram distance (0 identical, 1
+	// nothing in common) an alternative may have; one or two typos in a
+	// word stay well under it.
+	didYouMeanDistance = 0.5
+	// didYouMeanTimeout bounds the lookups a zero-result search waits for.
+	didYouMeanTimeout = 1500 * time.Millisecond
+)
+
+// trigrams returns the distinct three-character substrings of s, the grams
+// the ngram bloom filter indexes are built from.
+func trigrams(s string) []string {
+	r := []rune(s)
+	seen := map[string]bool{}
+	var out []string
+	for i := 0; i+3 <= len(r); i++ {
+		g := string(r[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// didYouMean looks for values close to the filled name, company and domain
+// filters of a search that found nothing, so typos can be corrected. Only
+// values sharing a trigram with the filter are read, which the ngram bloom
+// filter indexes narrow down to a few granules, and the distance is computed
+// once per distinct value. It is a best effort: fields whose lookup fails or
+// times out are left out, and nil is returned when nothing close was found.
+func (h *Handlers) didYouMean(ctx context.Context, req searchRequest) map[string][]string {
+	ctx, cancel := context.WithTimeout(ctx, didYouMeanTimeout)
+	defer cancel()
+	filled := map[string]string{}
+	for _, f := range req.fieldFilters() {
+		filled[f.field] = f.val
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		out map[string][]string
+	)
+	for _, f := range didYouMeanFields {
+		if m, _ := normMatchMode(req.Match[f.field]); m == matchRegex {
+			continue
+		}
+		val := strings.ToLower(strings.TrimSpace(filled[f.field]))
+		if n := len([]rune(val)); n < 3 || n > maxSuggestPrefix {
+			continue
+		}
+		wg.Add(1)
+		go func(field string, cols [2]string, val string) {
+			defer wg.Done()
+			values, err := h.closeValues(ctx, cols[0], cols[1], val)
+			if err != nil || len(values) == 0 {
+				return
+			}
+			mu.Lock()
+			if out == nil {
+				out = map[string][]string{}
+			}
+			out[field] = values
+			mu.Unlock()
+		}(f.field, f.cols, val)
+	}
+	wg.Wait()
+	return out
+}
+
+// closeValues returns the values of col closest to val by ngram distance,
+// grouped on its lowercased column lc.
+func (h *Handlers) closeValues(ctx context.Context, col, lc, val string) ([]string, error) {
+	query := fmt.Sprintf(`SELECT any(%s) AS v, ngramDistanceUTF8(%s, ?) AS d
+		FROM contacts
+		WHERE multiSearchAny(%s, ?) AND %s != ?
+		GROUP BY %s
+		HAVING d <= %g
+		ORDER BY d, v
+		LIMIT %d
+		SETTINGS max_threads = 4`, col, lc, lc, lc, lc, didYouMeanDistance, maxDidYouMean)
+	rows, err := h.ck.Query(ctx, query, val, trigrams(val), val)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		var d float32
+		if err := rows.Scan(&v, &d); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"net/http"
 	"os"
@@ -17,6 +18,17 @@ type resendEmail struct {
 }
 
 func sendVerificationEmail(to, link string) error {
+	return sendEmail(to, "Verify your email", "<p>Click to verify: <a href='"+link+"'>Verify Email</a></p>")
+}
+
+func sendAlertEmail(to, alertName string, matches int64, link string) error {
+	html := fmt.Sprintf("<p>%d new contacts matching your alert <b>%s</b> were just added.</p><p><a href='%s'>View matches</a></p>",
+		matches, template.HTMLEscapeString(alertName), link)
+	return sendEmail(to, "New matches for "+alertName, html)
+}
+
+// sendEmail delivers an HTML email through Resend.
+func sendEmail(to, subject, html string) error {
 	apiKey := os.Getenv("RESEND_API_KEY")
 	from := os.Getenv("RESEND_FROM_EMAIL")
 	if from == "" {
@@ -25,7 +37,7 @@ func sendVerificationEmail(to, link string) error {
 	if apiKey == "" {
 		return fmt.Errorf("RESEND_API_KEY not set")
 	}
-	body := resendEmail{From: from, To: []string{to}, Subject: "Verify your email", Html: "<p>Click to verify: <a href='" + link + "'>Verify Email</a></p>"}
+	body := resendEmail{From: from, To: []string{to}, Subject: subject, Html: html}
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", "https://api.resend.com/emails", bytes.NewReader(b))
 	req.Header.Set("Authorization", "Bearer "+apiKey)
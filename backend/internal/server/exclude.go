@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// excludeFilter removes contacts whose field matches any of Values under
+// Mode (contains by default), e.g.
+//
+//	{"field":"company","values":["recruiting","staffing"]}
+//	{"field":"domain","mode":"exact","values":["gmail.com","yahoo.com"]}
+//
+// Contacts with the field empty are kept.
+type excludeFilter struct {
+	Field  string   `json:"field"`
+	Mode   string   `json:"mode,omitempty"`
+	Values []string `json:"values"`
+}
+
+// compile returns NOT (cond OR cond ...), or an empty expression when every
+// value is empty. Each condition counts towards conds, which is shared by
+// every exclusion of a request; exact lists are a single NOT IN and don't
+// count.
+func (ex excludeFilter) compile(conds *int) (string, []any, error) {
+	field := strings.TrimSpace(ex.Field)
+	f, ok := searchFields[field]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: unknown exclude field %q", errInvalidQuery, ex.Field)
+	}
+	mode, err := normMatchMode(ex.Mode)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(ex.Values) > maxInValues {
+		return "", nil, fmt.Errorf("%w: more than %d %s exclusions", errInvalidQuery, maxInValues, field)
+	}
+	// a list of exact values is a single NOT IN
+	if mode == matchExact && !f.phone {
+		expr, args, err := inCondition("exclusions", f.expr, ex.Values)
+		if expr == "" || err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + expr + ")", args, nil
+	}
+	var parts []string
+	var args []any
+	for _, v := range ex.Values {
+		expr, a, err := fieldCondition(field, mode, v)
+		if err != nil {
+			return "", nil, err
+		}
+		if expr != "" {
+			*conds++
+			if *conds > maxQueryConditions {
+				return "", nil, fmt.Errorf("%w: more than %d exclusion conditions", errInvalidQuery, maxQueryConditions)
+			}
+			parts = append(parts, expr)
+			args = append(args, a...)
+		}
+	}
+	if len(parts) == 0 {
+		return "", nil, nil
+	}
+	return "NOT (" + strings.Join(parts, " OR ") + ")", args, nil
+}
+
+// excludeKey renders exclusions in normalized form for the search cache key,
+// e.g. company="recruiting","staffing";domain:exact="gmail.com".
+func excludeKey(filters []excludeFilter) string {
+	keys := make([]string, 0, len(filters))
+	for _, ex := range filters {
+		field := strings.TrimSpace(ex.Field)
+		if mode, _ := normMatchMode(ex.Mode); mode != matchContains {
+			field += ":" + mode
+		}
+		values := make([]string, 0, len(ex.Values))
+		for _, v := range ex.Values {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, strconv.Quote(normKeyValue(ex.Mode, v)))
+			}
+		}
+		sort.Strings(values)
+		keys = append(keys, field+"="+strings.Join(values, ","))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ";")
+}
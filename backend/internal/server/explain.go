@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// indexStep is one index ClickHouse applied when reading contacts, parsed
+// from EXPLAIN indexes=1.
+type indexStep struct {
+	Type        string `json:"type"` // MinMax, Partition, PrimaryKey or Skip
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Condition   string `json:"condition,omitempty"`
+	Parts       string `json:"parts,omitempty"`    // selected/total
+	Granules    string `json:"granules,omitempty"` // selected/total
+}
+
+// used reports whether the index dropped any granules.
+func (s indexStep) used() bool {
+	sel, total, ok := parseFraction(s.Granules)
+	return ok && sel < total
+}
+
+func parseFraction(s string) (uint64, uint64, bool) {
+	a, b, found := strings.Cut(s, "/")
+	if !found {
+		return 0, 0, false
+	}
+	x, err1 := strconv.ParseUint(strings.TrimSpace(a), 10, 64)
+	y, err2 := strconv.ParseUint(strings.TrimSpace(b), 10, 64)
+	return x, y, err1 == nil && err2 == nil
+}
+
+// parseIndexSteps extracts the Indexes section of an EXPLAIN indexes=1 plan:
+//
+//	Indexes:
+//	  PrimaryKey
+//	    Condition: true
+//	    Parts: 12/12
+//	    Granules: 4000/4000
+//	  Skip
+//	    Name: idx_company
+//	    Description: ngrambf_v1 GRANULARITY 1
+//	    Parts: 3/12
+//	    Granules: 41/4000
+func parseIndexSteps(plan []string) []indexStep {
+	var steps []indexStep
+	for _, line := range plan {
+		line = strings.TrimSpace(line)
+		switch line {
+		case "MinMax", "Partition", "PrimaryKey", "Skip":
+			steps = append(steps, indexStep{Type: line})
+			continue
+		}
+		if len(steps) == 0 {
+			continue
+		}
+		key, value, found := strings.Cut(line, ": ")
+		if !found {
+			continue
+		}
+		s := &steps[len(steps)-1]
+		switch key {
+		case "Name":
+			s.Name = value
+		case "Description":
+			s.Description = value
+		case "Condition":
+			s.Condition = value
+		case "Parts":
+			s.Parts = value
+		case "Granules":
+			s.Granules = value
+		}
+	}
+	return steps
+}
+
+// ExplainSearch shows how a searchRequest executes: the SQL Search would run,
+// the EXPLAIN indexes=1 plan and which skip indexes pruned granules. Both
+// queries are then run with Search's timeouts to report elapsed time and
+// rows read. Nothing is logged or charged.
+func (h *Handlers) ExplainSearch(c *gin.Context) {
+	var req searchRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if !searchOnly(c, req) {
+		return
+	}
+	page := req.Page
+	if page < 1 {
+		page = 1
+	}
+	size := req.PageSize
+	if size <= 0 || size > 1000 {
+		size = 100
+	}
+	offset := (page - 1) * size
+	where, args, err := compileSearch(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := resultOrder(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, dataWhere := contactSource(req.Dedupe, where)
+	dataArgs := args
+	if req.Cursor != "" {
+		sc, err := decodeCursor(req.Cursor, order, sortSignature(req.Sort))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		offset = 0
+		cw, cwArgs := cursorWhere(order, sc)
+		dataWhere = andWhere(dataWhere, cw)
+		dataArgs = append(append([]any{}, args...), cwArgs...)
+	}
+	dataQ := searchDataQuery(from, dataWhere, order, size, offset)
+	countQ := countQuery(req.Dedupe, where)
+
+	explainCtx, explainCancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer explainCancel()
+	rows, err := h.ck.Query(explainCtx, "EXPLAIN indexes = 1 "+dataQ, dataArgs...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var plan []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		plan = append(plan, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	steps := parseIndexSteps(plan)
+	usedSkip := []string{}
+	var granules string
+	for _, s := range steps {
+		if s.Type == "Skip" && s.used() {
+			usedSkip = append(usedSkip, s.Name)
+		}
+		if s.Granules != "" {
+			granules = s.Granules // each step filters the previous one's output
+		}
+	}
+
+	data := h.profileQuery(c, requestTimeout(c, 20*time.Second), dataQ, dataArgs, false)
+	count := h.profileQuery(c, 10*time.Second, countQ, args, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"sql":             dataQ,
+		"countSql":        countQ,
+		"args":            args,
+		"dataArgs":        dataArgs,
+		"plan":            plan,
+		"indexes":         steps,
+		"usedSkipIndexes": usedSkip,
+		"granules":        granules,
+		"data":            data,
+		"count":           count,
+	})
+}
+
+// queryProfile is the outcome of running one query for ExplainSearch.
+type queryProfile struct {
+	ElapsedMs int64   `json:"elapsedMs"`
+	RowsRead  uint64  `json:"rowsRead"`
+	BytesRead uint64  `json:"bytesRead"`
+	Rows      uint64  `json:"rows"` // rows returned, or the count for a count query
+	TimedOut  bool    `json:"timedOut,omitempty"`
+	Error     *string `json:"error,omitempty"`
+}
+
+// profileQuery runs query to completion within timeout, reading every row.
+func (h *Handlers) profileQuery(c *gin.Context, timeout time.Duration, query string, args []any, isCount bool) queryProfile {
+	var p queryProfile
+	var rowsRead, bytesRead atomic.Uint64
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	ctx = clickhouse.Context(ctx, clickhouse.WithProgress(func(pr *clickhouse.Progress) {
+		rowsRead.Add(pr.Rows)
+		bytesRead.Add(pr.Bytes)
+	}))
+
+	start := time.Now()
+	err := func() error {
+		if isCount {
+			return h.ck.QueryRow(ctx, query, args...).Scan(&p.Rows)
+		}
+		rows, err := h.ck.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			p.Rows++
+		}
+		return rows.Err()
+	}()
+	p.ElapsedMs = time.Since(start).Milliseconds()
+	p.RowsRead = rowsRead.Load()
+	p.BytesRead = bytesRead.Load()
+	if err != nil {
+		msg := err.Error()
+		p.Error = &msg
+		p.TimedOut = errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded)
+	}
+	return p
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// exportHeaders match the column names ingestFile recognizes, so an export
+// can be uploaded again as-is.
+var exportHeaders = []string{"name", "email", "phone", "linkedin", "position", "company", "company phone", "website", "domain", "facebook", "twitter", "linkedin company page", "country", "state"}
+
+func (r contactRow) exportRecord() []string {
+	return []string{r.Name, r.Email, r.Phone, r.Linkedin, r.Position, r.Company, r.CompanyPhone, r.Website, r.Domain, r.Facebook, r.Twitter, r.LinkedinCompanyPage, r.Country, r.State}
+}
+
+// ExportSearch streams every contact matching a searchRequest as CSV or XLSX.
+// The export costs one search from the daily quota and is capped at the
+// user's export_row_limit, sent as X-Export-Row-Limit. A CSV cut off at the
+// limit ends with a TRUNCATED row; an XLSX is built in memory before it is
+// sent, so it carries X-Export-Truncated instead.
+func (h *Handlers) ExportSearch(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "auth required"})
+		return
+	}
+	userID := userIDAny.(string)
+	fingerprintAny, _ := c.Get("device_fingerprint")
+	fingerprint, _ := fingerprintAny.(string)
+
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "csv")))
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+
+	var req searchRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if !searchOnly(c, req) {
+		return
+	}
+	where, args, err := compileSearch(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := resultOrder(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	usageDate := istUsageDate()
+	exceeded, err := h.quotaExceeded(c.Request.Context(), userID, usageDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed quota"})
+		return
+	}
+	if exceeded {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "daily search limit reached"})
+		return
+	}
+	var rowLimit int
+	if err := h.pg.QueryRow(c.Request.Context(), `SELECT export_row_limit FROM users WHERE id = $1`, userID).Scan(&rowLimit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed export limit"})
+		return
+	}
+	if rowLimit <= 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "exports are not enabled for this account"})
+		return
+	}
+
+	// Exports are masked like search results except for contacts the user
+	// has revealed.
+	maskRow, err := h.rowMasker(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ckCtx, ckCancel := context.WithTimeout(c.Request.Context(), requestTimeout(c, 5*time.Minute))
+	defer ckCancel()
+	from, outerWhere := contactSource(req.Dedupe, where)
+	query := fmt.Sprintf(`SELECT %s
+		FROM %s
+		WHERE %s
+		ORDER BY %s
+		LIMIT %d
+		SETTINGS max_threads = 4`, contactColumns, from, outerWhere, orderByClause(order), rowLimit+1)
+	rows, err := h.ck.Query(ckCtx, query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("finpro-export-%s.%s", time.Now().Format("20060102-150405"), format)
+	disposition := fmt.Sprintf(`attachment; filename="%s"`, filename)
+
+	// one row past the limit is read to tell a truncated export from one that
+	// fits exactly
+	var exported int64
+	var truncated bool
+	var failed error
+	switch format {
+	case "csv":
+		c.Header("Content-Disposition", disposition)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("X-Export-Row-Limit", strconv.Itoa(rowLimit))
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		_ = w.Write(exportHeaders)
+		for rows.Next() {
+			if exported == int64(rowLimit) {
+				truncated = true
+				break
+			}
+			r, err := scanContact(rows)
+			if err != nil {
+				failed = err
+				break
+			}
+			maskRow(&r)
+			_ = w.Write(r.exportRecord())
+			exported++
+			// flush periodically so large exports reach the client as they are read
+			if exported%1000 == 0 {
+				w.Flush()
+				c.Writer.Flush()
+			}
+		}
+		if failed == nil {
+			failed = rows.Err()
+		}
+		if failed != nil {
+			// the 200 is already sent; end the file with a row saying it is
+			// incomplete rather than passing it off as the whole export
+			fmt.Println("export error:", failed)
+			_ = w.Write([]string{"ERROR: export incomplete: " + failed.Error()})
+		} else if truncated {
+			_ = w.Write([]string{fmt.Sprintf("TRUNCATED: export limited to %d rows", rowLimit)})
+		}
+		w.Flush()
+	case "xlsx":
+		f := excelize.NewFile()
+		defer f.Close()
+		sheet := f.GetSheetName(0)
+		sw, err := f.NewStreamWriter(sheet)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		_ = sw.SetRow("A1", toCells(exportHeaders))
+		for rows.Next() {
+			if exported == int64(rowLimit) {
+				truncated = true
+				break
+			}
+			r, err := scanContact(rows)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			maskRow(&r)
+			cell, _ := excelize.CoordinatesToCellName(1, int(exported)+2)
+			if err := sw.SetRow(cell, toCells(r.exportRecord())); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			exported++
+		}
+		if err := rows.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := sw.Flush(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		buf, err := f.WriteToBuffer()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", disposition)
+		c.Header("X-Export-Row-Limit", strconv.Itoa(rowLimit))
+		c.Header("X-Export-Truncated", strconv.FormatBool(truncated))
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+	}
+	if failed != nil {
+		return
+	}
+
+	// Log the export and charge it like a search; the body has already been
+	// sent so failures here are not surfaced to the client. Incomplete
+	// exports are neither.
+	normalizedKey := fmt.Sprintf("export=%s|%s|limit=%d", format, queryKey(req), rowLimit)
+	if sortSig := sortSignature(req.Sort); sortSig != "" {
+		normalizedKey += "|sort=" + sortSig
+	}
+	_, _ = h.pg.Exec(context.Background(), `INSERT INTO user_search_logs (user_id, device_fingerprint, ip_address, user_agent, params, normalized_key, total_results, snapshot)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,NULL)`, userID, fingerprint, c.ClientIP(), c.Request.UserAgent(), toJSON(req), normalizedKey, exported)
+	if exported > 0 {
+		h.chargeSearch(context.Background(), userID, usageDate)
+	}
+}
+
+func toCells(values []string) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// facetDims are the columns SearchFacets aggregates. Values are grouped on
+// the lowercased column so "IBM" and "ibm" count together.
+var facetDims = []struct {
+	name string
+	col  string
+	lc   string
+}{
+	{"company", "company", "company_lc"},
+	{"domain", "domain", "domain_lc"},
+	{"position", "position", "position_lc"},
+	{"country", "country", "country_lc"},
+	{"state", "state", "state_lc"},
+	{"seniority", "seniority", "seniority"},
+	{"department", "department", "department"},
+}
+
+type facetValue struct {
+	Value string `json:"value"`
+	Count uint64 `json:"count"`
+}
+
+// SearchFacets returns the top values of facetDims over every contact that
+// matches a searchRequest, plus the total match count. No contacts are
+// returned, so it does not count against the daily quota, but it is refused
+// once the quota is used up.
+func (h *Handlers) SearchFacets(c *gin.Context) {
+	userIDAny, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "auth required"})
+		return
+	}
+	userID := userIDAny.(string)
+
+	top, ok := topParam(c)
+	if !ok {
+		return
+	}
+
+	var req searchRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	if !searchOnly(c, req) {
+		return
+	}
+	where, args, err := compileSearch(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exceeded, err := h.quotaExceeded(c.Request.Context(), userID, istUsageDate())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed quota"})
+		return
+	}
+	if exceeded {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "daily search limit reached"})
+		return
+	}
+
+	ckCtx, ckCancel := context.WithTimeout(c.Request.Context(), requestTimeout(c, 20*time.Second))
+	defer ckCancel()
+	// with dedupe, facets count merged people like Search's total does
+	from, outerWhere := contactSource(req.Dedupe, where)
+
+	// Run the count and one GROUP BY per dimension in parallel
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		total    uint64
+		facets   = make(map[string][]facetValue, len(facetDims))
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := h.ck.QueryRow(ckCtx, countQuery(req.Dedupe, where), args...).Scan(&total); err != nil {
+			fail(err)
+		}
+	}()
+
+	for _, dim := range facetDims {
+		wg.Add(1)
+		go func(name, col, lc string) {
+			defer wg.Done()
+			values, err := h.topValues(ckCtx, from, col, lc, outerWhere, args, top)
+			if err != nil {
+				fail(err)
+				return
+			}
+			mu.Lock()
+			facets[name] = values
+			mu.Unlock()
+		}(dim.name, dim.col, dim.lc)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": firstErr.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "facets": facets})
+}
+
+// topParam reads the ?top= query parameter (1-50, default 10), responding
+// with 400 when it is invalid.
+func topParam(c *gin.Context) (int, bool) {
+	v := c.Query("top")
+	if v == "" {
+		return 10, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "top must be between 1 and 50"})
+		return 0, false
+	}
+	return n, true
+}
+
+// topValues returns the most common non-empty values of col among rows of
+// from matching where, grouped on its lowercased column lc.
+func (h *Handlers) topValues(ctx context.Context, from, col, lc, where string, args []any, top int) ([]facetValue, error) {
+	query := fmt.Sprintf(`SELECT any(%s) AS value, count() AS c
+		FROM %s
+		WHERE %s AND %s != ''
+		GROUP BY %s
+		ORDER BY c DESC
+		LIMIT %d
+		SETTINGS max_threads = 4`, col, from, where, lc, lc, top)
+	rows, err := h.ck.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := []facetValue{}
+	for rows.Next() {
+		var v facetValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 
@@ -12,6 +13,7 @@ type Handlers struct {
 	pg        *pgxpool.Pool
 	ck        ch.Conn
 	ingestSem chan struct{}
+	titles    *titleRules
 }
 
 func NewHandlers(pg *pgxpool.Pool, ck ch.Conn) *Handlers {
@@ -19,7 +21,12 @@ func NewHandlers(pg *pgxpool.Pool, ck ch.Conn) *Handlers {
 	if max < 1 {
 		max = 1
 	}
-	return &Handlers{pg: pg, ck: ck, ingestSem: make(chan struct{}, max)}
+	titles, err := loadTitleRules(os.Getenv("TITLE_RULES_FILE"))
+	if err != nil {
+		fmt.Println("title rules:", err, "- using built-in rules")
+		titles, _ = loadTitleRules("")
+	}
+	return &Handlers{pg: pg, ck: ck, ingestSem: make(chan struct{}, max), titles: titles}
 }
 
 func getIntEnv(k string, d int) int {
@@ -12,8 +12,9 @@ import (
 	"time"
 )
 
-// ingestFile reads a CSV and inserts rows into ClickHouse in batches.
-func (h *Handlers) ingestFile(ctx context.Context, uploadID int64, path string) {
+// ingestFile reads a CSV and inserts rows into ClickHouse in batches,
+// reporting whether the upload succeeded.
+func (h *Handlers) ingestFile(ctx context.Context, uploadID int64, path string) bool {
 	start := time.Now()
 	defer func() {
 		_, _ = h.pg.Exec(context.Background(), `UPDATE uploads SET updated_at=now() WHERE id=$1`, uploadID)
@@ -25,7 +26,7 @@ func (h *Handlers) ingestFile(ctx context.Context, uploadID int64, path string)
 	f, err := os.Open(path)
 	if err != nil {
 		h.failUpload(uploadID, fmt.Errorf("open: %w", err))
-		return
+		return false
 	}
 	defer f.Close()
 
@@ -36,23 +37,23 @@ func (h *Handlers) ingestFile(ctx context.Context, uploadID int64, path string)
 	headers, err := reader.Read()
 	if err != nil {
 		h.failUpload(uploadID, fmt.Errorf("read header: %w", err))
-		return
+		return false
 	}
 	cols := mapHeaders(headers)
 	if len(cols.idx) == 0 {
 		h.failUpload(uploadID, errors.New("no recognized columns in CSV"))
-		return
+		return false
 	}
 
 	batchSize := 5000
 	inserted := int64(0)
 
 	batch, err := h.ck.PrepareBatch(ctx, `INSERT INTO contacts (
-		name, email, phone, linkedin, position, company, company_phone, website, domain, facebook, twitter, linkedin_company_page, country, state, file_id, created_at
+		name, email, phone, linkedin, position, company, company_phone, website, domain, facebook, twitter, linkedin_company_page, country, state, phone_e164, company_phone_e164, seniority, department, file_id, created_at, id
 	) VALUES`)
 	if err != nil {
 		h.failUpload(uploadID, fmt.Errorf("prepare batch: %w", err))
-		return
+		return false
 	}
 	flush := func() error {
 		if batch.Rows() == 0 {
@@ -62,7 +63,7 @@ func (h *Handlers) ingestFile(ctx context.Context, uploadID int64, path string)
 			return err
 		}
 		batch, err = h.ck.PrepareBatch(ctx, `INSERT INTO contacts (
-			name, email, phone, linkedin, position, company, company_phone, website, domain, facebook, twitter, linkedin_company_page, country, state, file_id, created_at
+			name, email, phone, linkedin, position, company, company_phone, website, domain, facebook, twitter, linkedin_company_page, country, state, phone_e164, company_phone_e164, seniority, department, file_id, created_at, id
 		) VALUES`)
 		return err
 	}
@@ -78,10 +79,11 @@ func (h *Handlers) ingestFile(ctx context.Context, uploadID int64, path string)
 		}
 		if err != nil {
 			h.failUpload(uploadID, fmt.Errorf("read: %w", err))
-			return
+			return false
 		}
 
 		row := extractRow(rec, cols)
+		row.seniority, row.department = h.titles.classify(row.position)
 		if err := batch.Append(
 			row.name,
 			row.email,
@@ -97,11 +99,16 @@ func (h *Handlers) ingestFile(ctx context.Context, uploadID int64, path string)
 			row.linkedinCompanyPage,
 			row.country,
 			row.state,
+			row.phoneE164,
+			row.companyPhoneE164,
+			row.seniority,
+			row.department,
 			uploadID,
 			time.Now(),
+			contactID(uploadID, inserted+1),
 		); err != nil {
 			h.failUpload(uploadID, fmt.Errorf("append: %w", err))
-			return
+			return false
 		}
 		inserted++
 		// periodic progress update
@@ -113,19 +120,20 @@ func (h *Handlers) ingestFile(ctx context.Context, uploadID int64, path string)
 		if batch.Rows() >= batchSize {
 			if err := flush(); err != nil {
 				h.failUpload(uploadID, fmt.Errorf("flush: %w", err))
-				return
+				return false
 			}
 		}
 	}
 	if err := flush(); err != nil {
 		h.failUpload(uploadID, fmt.Errorf("final flush: %w", err))
-		return
+		return false
 	}
 
 	_, _ = h.pg.Exec(ctx, `UPDATE uploads SET status='succeeded', row_count=$2, processed_rows=$2, progress_pct=100, updated_at=now() WHERE id=$1`, uploadID, inserted)
 	_ = os.Chtimes(path, time.Now(), time.Now())
 	_ = os.Remove(path)
 	fmt.Printf("ingested upload_id=%d rows=%d in %s\n", uploadID, inserted, time.Since(start))
+	return true
 }
 
 type csvRow struct {
@@ -143,6 +151,10 @@ type csvRow struct {
 	linkedinCompanyPage string
 	country             string
 	state               string
+	phoneE164           string
+	companyPhoneE164    string
+	seniority           string
+	department          string
 }
 
 type headerCols struct {
@@ -166,7 +178,7 @@ func get(h headerCols, rec []string, key string) string {
 }
 
 func extractRow(rec []string, cols headerCols) csvRow {
-	return csvRow{
+	row := csvRow{
 		name:                get(cols, rec, "name"),
 		email:               get(cols, rec, "email"),
 		phone:               get(cols, rec, "phone"),
@@ -182,6 +194,15 @@ func extractRow(rec []string, cols headerCols) csvRow {
 		country:             get(cols, rec, "country"),
 		state:               get(cols, rec, "state"),
 	}
+	row.phoneE164 = normalizePhone(row.phone, row.country)
+	row.companyPhoneE164 = normalizePhone(row.companyPhone, row.country)
+	return row
+}
+
+// contactID packs the upload and the 1-based row number within it, so ids
+// are unique without coordinating between concurrent ingests.
+func contactID(uploadID, rowNum int64) uint64 {
+	return uint64(uploadID)<<32 | uint64(rowNum)&0xffffffff
 }
 
 func (h *Handlers) failUpload(id int64, err error) {
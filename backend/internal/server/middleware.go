@@ -5,7 +5,10 @@ import (
 	"encoding/hex"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -114,3 +117,64 @@ func (h *Handlers) AdminMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// rateLimiter allows each key a fixed number of requests per window.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, hits: map[string]*rateWindow{}}
+}
+
+// allow records a request for key and reports whether it is within the limit.
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	w, ok := l.hits[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		// drop expired windows now and then so idle users don't accumulate
+		if len(l.hits) > 10000 {
+			for k, v := range l.hits {
+				if now.Sub(v.start) >= l.window {
+					delete(l.hits, k)
+				}
+			}
+		}
+		l.hits[key] = &rateWindow{start: now, count: 1}
+		return true
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// RateLimitMiddleware limits each authenticated user to l's rate; it must run
+// after AuthMiddleware.
+func RateLimitMiddleware(l *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		key, _ := userID.(string)
+		if key == "" {
+			key = c.ClientIP()
+		}
+		if !l.allow(key) {
+			c.Header("Retry-After", strconv.Itoa(int(l.window.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
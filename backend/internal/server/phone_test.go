@@ -0,0 +1,33 @@
+package server
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		raw, country, want string
+	}{
+		{"", "US", ""},
+		{"n/a", "US", ""},
+		{"+1 (555) 123-4567", "", "+15551234567"},
+		{"(555) 123-4567", "United States", "+15551234567"},
+		{"1-555-123-4567", "US", "+15551234567"},
+		{"011 44 20 7946 0958", "US", "+442079460958"},
+		{"0044 20 7946 0958", "", "+442079460958"},
+		{"+44 (0)20 7946 0958", "", "+442079460958"},
+		{"020 7946 0958", "United Kingdom", "+442079460958"},
+		{"8 (495) 123-45-67", "Russia", "+74951234567"},
+		{"06 1234 5678", "IT", "+390612345678"},
+		{"91 98765 43210", "India", "+919876543210"},
+		{"98765 43210", "India", "+919876543210"},
+		// legacy fallback: digits only when the number can't be resolved
+		{"(555) 123-4567", "", "5551234567"},
+		{"555-1234", "Atlantis", "5551234"},
+		{"12", "US", "12"},
+		{"+1 234 5678 9012 3456 78", "", "123456789012345678"},
+	}
+	for _, tt := range tests {
+		if got := normalizePhone(tt.raw, tt.country); got != tt.want {
+			t.Errorf("normalizePhone(%q, %q) = %q, want %q", tt.raw, tt.country, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// contactFields are the contactRow fields a search can project, by JSON name.
+var contactFields = []struct {
+	name string
+	get  func(r *contactRow) any
+}{
+	{"name", func(r *contactRow) any { return r.Name }},
+	{"email", func(r *contactRow) any { return r.Email }},
+	{"phone", func(r *contactRow) any { return r.Phone }},
+	{"linkedin", func(r *contactRow) any { return r.Linkedin }},
+	{"position", func(r *contactRow) any { return r.Position }},
+	{"company", func(r *contactRow) any { return r.Company }},
+	{"companyPhone", func(r *contactRow) any { return r.CompanyPhone }},
+	{"website", func(r *contactRow) any { return r.Website }},
+	{"domain", func(r *contactRow) any { return r.Domain }},
+	{"facebook", func(r *contactRow) any { return r.Facebook }},
+	{"twitter", func(r *contactRow) any { return r.Twitter }},
+	{"linkedinCompanyPage", func(r *contactRow) any { return r.LinkedinCompanyPage }},
+	{"country", func(r *contactRow) any { return r.Country }},
+	{"state", func(r *contactRow) any { return r.State }},
+	{"seniority", func(r *contactRow) any { return r.Seniority }},
+	{"department", func(r *contactRow) any { return r.Department }},
+	{"fileId", func(r *contactRow) any { return r.FileID }},
+	{"sourceFile", func(r *contactRow) any { return r.SourceFile }},
+	{"id", func(r *contactRow) any { return strconv.FormatUint(r.ID, 10) }},
+}
+
+// rowProjection is the subset of contactFields a search returns, as indexes
+// into contactFields; nil returns whole rows.
+type rowProjection []int
+
+// parseFields validates the requested field names.
+func parseFields(fields []string) (rowProjection, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	p := rowProjection{}
+	seen := map[int]bool{}
+	for _, f := range fields {
+		i := -1
+		for j, cf := range contactFields {
+			if cf.name == strings.TrimSpace(f) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("%w: unknown field %q", errInvalidQuery, f)
+		}
+		if !seen[i] {
+			seen[i] = true
+			p = append(p, i)
+		}
+	}
+	return p, nil
+}
+
+// encode renders r as a JSON object holding only the projected fields, plus
+// masked, score and highlights when set.
+func (p rowProjection) encode(r *contactRow) []byte {
+	if p == nil {
+		b, _ := json.Marshal(r)
+		return b
+	}
+	b := []byte{'{'}
+	for n, i := range p {
+		if n > 0 {
+			b = append(b, ',')
+		}
+		v, _ := json.Marshal(contactFields[i].get(r))
+		b = append(append(append(b, strconv.Quote(contactFields[i].name)...), ':'), v...)
+	}
+	if r.Masked {
+		b = append(b, `,"masked":true`...)
+	}
+	if r.Score != 0 {
+		b = append(b, `,"score":`+strconv.FormatUint(r.Score, 10)...)
+	}
+	if len(r.Highlights) > 0 {
+		hl, _ := json.Marshal(r.Highlights)
+		b = append(append(b, `,"highlights":`...), hl...)
+	}
+	return append(b, '}')
+}
+
+// rows projects rows for a JSON response.
+func (p rowProjection) rows(rows []contactRow) any {
+	if p == nil {
+		return rows
+	}
+	out := make([]json.RawMessage, len(rows))
+	for i := range rows {
+		out[i] = p.encode(&rows[i])
+	}
+	return out
+}
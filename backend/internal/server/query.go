@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits for structured queries so a single request can't compile to an
+// arbitrarily large WHERE clause.
+const (
+	maxQueryDepth      = 5
+	maxQueryConditions = 50
+)
+
+var errInvalidQuery = errors.New("invalid query")
+
+// queryNode is one node of a structured search query. A node is either a
+// group (Op is AND, OR or NOT with Children) or a condition on a single
+// field, e.g.
+//
+//	{"op":"AND","children":[
+//	  {"op":"OR","children":[{"field":"company","value":"bank"},{"field":"domain","value":"bank"}]},
+//	  {"op":"NOT","children":[{"field":"position","value":"intern"}]}]}
+type queryNode struct {
+	Op       string      `json:"op,omitempty"`
+	Children []queryNode `json:"children,omitempty"`
+	Field    string      `json:"field,omitempty"`
+	Mode     string      `json:"mode,omitempty"`
+	Value    string      `json:"value,omitempty"`
+}
+
+// compileQuery validates q and compiles it to a parameterized ClickHouse
+// expression. Conditions with empty values are dropped, as are groups left
+// with no conditions, so the expression may be empty.
+func compileQuery(q queryNode) (string, []any, error) {
+	conds := 0
+	return q.compile(1, &conds)
+}
+
+func (n queryNode) compile(depth int, conds *int) (string, []any, error) {
+	if depth > maxQueryDepth {
+		return "", nil, fmt.Errorf("%w: nested deeper than %d levels", errInvalidQuery, maxQueryDepth)
+	}
+	op := strings.ToUpper(strings.TrimSpace(n.Op))
+	if op == "" {
+		if len(n.Children) > 0 {
+			return "", nil, fmt.Errorf("%w: group is missing op", errInvalidQuery)
+		}
+		field := strings.TrimSpace(n.Field)
+		if _, ok := searchFields[field]; !ok {
+			return "", nil, fmt.Errorf("%w: unknown field %q", errInvalidQuery, n.Field)
+		}
+		*conds++
+		if *conds > maxQueryConditions {
+			return "", nil, fmt.Errorf("%w: more than %d conditions", errInvalidQuery, maxQueryConditions)
+		}
+		return fieldCondition(field, n.Mode, n.Value)
+	}
+	if n.Field != "" {
+		return "", nil, fmt.Errorf("%w: %s group cannot have a field", errInvalidQuery, op)
+	}
+	switch op {
+	case "AND", "OR":
+	case "NOT":
+		if len(n.Children) != 1 {
+			return "", nil, fmt.Errorf("%w: NOT takes exactly one child", errInvalidQuery)
+		}
+	default:
+		return "", nil, fmt.Errorf("%w: unknown op %q", errInvalidQuery, n.Op)
+	}
+
+	var parts []string
+	var args []any
+	for _, child := range n.Children {
+		expr, childArgs, err := child.compile(depth+1, conds)
+		if err != nil {
+			return "", nil, err
+		}
+		if expr == "" {
+			continue
+		}
+		parts = append(parts, expr)
+		args = append(args, childArgs...)
+	}
+	if len(parts) == 0 {
+		return "", nil, nil
+	}
+	if op == "NOT" {
+		return "NOT (" + parts[0] + ")", args, nil
+	}
+	return "(" + strings.Join(parts, " "+op+" ") + ")", args, nil
+}
+
+// key renders the query in normalized form for the search cache key,
+// e.g. and(or(company="bank",domain:suffix=".bank"),not(position="intern")).
+func (n queryNode) key() string {
+	op := strings.ToLower(strings.TrimSpace(n.Op))
+	if op == "" {
+		field := strings.TrimSpace(n.Field)
+		if mode, _ := normMatchMode(n.Mode); mode != matchContains {
+			field += ":" + mode
+		}
+		return field + "=" + strconv.Quote(normKeyValue(n.Mode, n.Value))
+	}
+	parts := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		parts[i] = child.key()
+	}
+	return op + "(" + strings.Join(parts, ",") + ")"
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// relevanceSort is the sort field ordering results by relevanceExpr.
+const relevanceSort = "relevance"
+
+// completenessExpr counts a contact's filled core fields. It stays below 10
+// so it only breaks ties between rows that match equally well.
+const completenessExpr = `(name != '') + (email != '') + (phone != '') + (linkedin != '') + (position != '') + (company != '') + (company_phone != '') + (website != '') + (domain != '')`
+
+// chLiteral renders s as a ClickHouse string expression. Relevance terms are
+// inlined rather than bound since the score appears in the select list,
+// ORDER BY and cursor condition; hex keeps ? and $n in user input away from
+// the driver's parameter binding.
+func chLiteral(s string) string {
+	return "unhex('" + hex.EncodeToString([]byte(s)) + "')"
+}
+
+// fieldScore scores how well one flat field filter matches: 3 for the whole
+// value, 2 for a prefix (or suffix in suffix mode) and 1 for a substring or
+// regex match, or "" when the filter is empty. It mirrors fieldCondition.
+func fieldScore(field, mode, val string) string {
+	f := searchFields[field]
+	mode, _ = normMatchMode(mode)
+	if f.phone && mode != matchRegex {
+		key, international := phoneSearchKey(val)
+		switch {
+		case key == "":
+			return ""
+		case international:
+			// legacy rows hold the digits without the +, as in phoneCondition
+			plus, bare := chLiteral("+"+key), chLiteral(key)
+			return "multiIf(" + f.expr + " IN (" + plus + ", " + bare + "), 3, startsWith(" + f.expr + ", " + plus + ") OR startsWith(" + f.expr + ", " + bare + "), 2, position(" + f.expr + ", " + bare + ") > 0, 1, 0)"
+		}
+		return "multiIf(endsWith(" + f.expr + ", " + chLiteral(key) + "), 3, position(" + f.expr + ", " + chLiteral(key) + ") > 0, 1, 0)"
+	}
+	val = strings.TrimSpace(val)
+	if mode == matchSuffix {
+		val = strings.TrimLeft(val, "*")
+	}
+	if val == "" {
+		return ""
+	}
+	if mode == matchRegex {
+		return "match(" + f.expr + ", " + chLiteral("(?i)"+val) + ")"
+	}
+	v := chLiteral(strings.ToLower(val))
+	switch mode {
+	case matchExact:
+		return "3 * (" + f.expr + " = " + v + ")"
+	case matchPrefix:
+		return "multiIf(" + f.expr + " = " + v + ", 3, startsWith(" + f.expr + ", " + v + "), 2, 0)"
+	case matchSuffix:
+		return "multiIf(" + f.expr + " = " + v + ", 3, endsWith(" + f.expr + ", " + v + "), 2, 0)"
+	}
+	return "multiIf(" + f.expr + " = " + v + ", 3, startsWith(" + f.expr + ", " + v + "), 2, position(" + f.expr + ", " + v + ") > 0, 1, 0)"
+}
+
+// matchScores lists the score terms of a request's flat fields and q words.
+// q words always match somewhere, so they score by whether they start the
+// name or company.
+func matchScores(req searchRequest) []string {
+	var terms []string
+	for _, f := range req.fieldFilters() {
+		if s := fieldScore(f.field, req.Match[f.field], f.val); s != "" {
+			terms = append(terms, s)
+		}
+	}
+	for _, t := range searchTokens(req.Q) {
+		v := chLiteral(t)
+		terms = append(terms, "multiIf(name_lc = "+v+" OR company_lc = "+v+", 3, startsWith(name_lc, "+v+") OR startsWith(company_lc, "+v+"), 2, 1)")
+	}
+	return terms
+}
+
+// relevanceExpr scores contacts against a request: ten points per point of
+// match quality summed over the filled fields, so under OR logic rows
+// matching more fields rank higher, plus completenessExpr.
+func relevanceExpr(req searchRequest) string {
+	terms := matchScores(req)
+	if len(terms) == 0 {
+		return "toUInt64(" + completenessExpr + ")"
+	}
+	return "toUInt64(10 * (" + strings.Join(terms, " + ") + ") + " + completenessExpr + ")"
+}
+
+// matchRange is a matched span of a field value, as [start, end) offsets in
+// characters.
+type matchRange [2]int
+
+// highlightFields are the fields match ranges are reported for. Phone
+// numbers are matched on their E.164 digits, which don't line up with the
+// stored formatting, so they are left out.
+var highlightFields = map[string]func(r *contactRow) string{
+	"name":                func(r *contactRow) string { return r.Name },
+	"email":               func(r *contactRow) string { return r.Email },
+	"linkedin":            func(r *contactRow) string { return r.Linkedin },
+	"position":            func(r *contactRow) string { return r.Position },
+	"company":             func(r *contactRow) string { return r.Company },
+	"website":             func(r *contactRow) string { return r.Website },
+	"domain":              func(r *contactRow) string { return r.Domain },
+	"facebook":            func(r *contactRow) string { return r.Facebook },
+	"linkedinCompanyPage": func(r *contactRow) string { return r.LinkedinCompanyPage },
+}
+
+// qFields are the fields q words are matched against (see search_text).
+var qFields = []string{"name", "email", "company", "position", "domain", "linkedin"}
+
+// highlightTerm is one value to look for in a field.
+type highlightTerm struct {
+	field string
+	mode  string
+	val   []rune // lower-cased
+	re    *regexp.Regexp
+}
+
+// highlighter finds where a request's flat fields and q words matched.
+type highlighter []highlightTerm
+
+func newHighlighter(req searchRequest) highlighter {
+	var h highlighter
+	for _, f := range req.fieldFilters() {
+		if _, ok := highlightFields[f.field]; !ok {
+			continue
+		}
+		mode, _ := normMatchMode(req.Match[f.field])
+		val := strings.TrimSpace(f.val)
+		if mode == matchSuffix {
+			val = strings.TrimLeft(val, "*")
+		}
+		if val == "" {
+			continue
+		}
+		t := highlightTerm{field: f.field, mode: mode, val: []rune(strings.ToLower(val))}
+		if mode == matchRegex {
+			re, err := regexp.Compile("(?i)" + val)
+			if err != nil {
+				continue
+			}
+			t.re = re
+		}
+		h = append(h, t)
+	}
+	for _, tok := range searchTokens(req.Q) {
+		for _, field := range qFields {
+			h = append(h, highlightTerm{field: field, mode: matchContains, val: []rune(tok)})
+		}
+	}
+	return h
+}
+
+// ranges returns the merged match ranges in each field of r, or nil when
+// nothing matched.
+func (h highlighter) ranges(r *contactRow) map[string][]matchRange {
+	var out map[string][]matchRange
+	for _, t := range h {
+		s := highlightFields[t.field](r)
+		if s == "" {
+			continue
+		}
+		found := t.find(s)
+		if len(found) == 0 {
+			continue
+		}
+		if out == nil {
+			out = map[string][]matchRange{}
+		}
+		out[t.field] = append(out[t.field], found...)
+	}
+	for field, rs := range out {
+		out[field] = mergeRanges(rs)
+	}
+	return out
+}
+
+func (t highlightTerm) find(s string) []matchRange {
+	if t.re != nil {
+		var out []matchRange
+		for _, m := range t.re.FindAllStringIndex(s, -1) {
+			if m[0] < m[1] {
+				out = append(out, matchRange{utf8.RuneCountInString(s[:m[0]]), utf8.RuneCountInString(s[:m[1]])})
+			}
+		}
+		return out
+	}
+	// ToLower maps rune by rune, so offsets carry over to s
+	text := []rune(strings.ToLower(s))
+	n := len(t.val)
+	if n == 0 || n > len(text) {
+		return nil
+	}
+	switch t.mode {
+	case matchExact:
+		if string(text) == string(t.val) {
+			return []matchRange{{0, n}}
+		}
+	case matchPrefix:
+		if string(text[:n]) == string(t.val) {
+			return []matchRange{{0, n}}
+		}
+	case matchSuffix:
+		if string(text[len(text)-n:]) == string(t.val) {
+			return []matchRange{{len(text) - n, len(text)}}
+		}
+	default:
+		var out []matchRange
+		for i := 0; i+n <= len(text); i++ {
+			if string(text[i:i+n]) == string(t.val) {
+				out = append(out, matchRange{i, i + n})
+				i += n - 1
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// mergeRanges sorts ranges and joins those that overlap or touch.
+func mergeRanges(rs []matchRange) []matchRange {
+	sort.Slice(rs, func(i, j int) bool { return rs[i][0] < rs[j][0] })
+	out := rs[:1]
+	for _, r := range rs[1:] {
+		last := &out[len(out)-1]
+		if r[0] <= last[1] {
+			if r[1] > last[1] {
+				last[1] = r[1]
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// highlight sets the match ranges of each row.
+func (h highlighter) highlight(rows []contactRow) {
+	if len(h) == 0 {
+		return
+	}
+	for i := range rows {
+		rows[i].Highlights = h.ranges(&rows[i])
+	}
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxRevealIDs bounds how many contacts one reveal request can unmask.
+const maxRevealIDs = 100
+
+// maskEmail keeps the first character of the local part and the domain,
+// e.g. j***@acme.com.
+func maskEmail(s string) string {
+	if s == "" {
+		return s
+	}
+	local, domain, found := strings.Cut(s, "@")
+	if !found {
+		return maskKeep(s, 1)
+	}
+	return maskKeep(local, 1) + "@" + domain
+}
+
+func maskKeep(s string, keep int) string {
+	r := []rune(s)
+	if len(r) <= keep {
+		return s + "***"
+	}
+	return string(r[:keep]) + "***"
+}
+
+// maskPhone hides all but the last two digits and keeps the formatting,
+// e.g. +1 (555) 123-4567 becomes +* (***) ***-**67.
+func maskPhone(s string) string {
+	digits := len(onlyDigits(s))
+	var b strings.Builder
+	seen := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			seen++
+			if seen <= digits-2 {
+				b.WriteRune('*')
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (r *contactRow) mask() {
+	r.Email = maskEmail(r.Email)
+	r.Phone = maskPhone(r.Phone)
+	r.CompanyPhone = maskPhone(r.CompanyPhone)
+	// ranges in the unmasked email would point at masked characters
+	delete(r.Highlights, "email")
+	r.Masked = true
+}
+
+// maskRows masks email and phone numbers in rows the user has not revealed.
+// Admins always see full records.
+func (h *Handlers) maskRows(c *gin.Context, rows []contactRow) []contactRow {
+	if role, _ := c.Get("role"); role == "ADMIN" || len(rows) == 0 {
+		return rows
+	}
+	userIDAny, _ := c.Get("user_id")
+	ids := make([]uint64, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+	}
+	revealed, _ := h.revealedIDs(c.Request.Context(), fmt.Sprintf("%v", userIDAny), ids)
+	out := make([]contactRow, len(rows))
+	for i, r := range rows {
+		if !revealed[r.ID] {
+			r.mask()
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// rowMasker returns a function masking rows the user has not revealed, for
+// responses streamed row by row. It loads all of the user's reveals up front
+// rather than querying per row.
+func (h *Handlers) rowMasker(c *gin.Context) (func(r *contactRow), error) {
+	if role, _ := c.Get("role"); role == "ADMIN" {
+		return func(*contactRow) {}, nil
+	}
+	userIDAny, _ := c.Get("user_id")
+	revealed, err := h.revealedIDs(c.Request.Context(), fmt.Sprintf("%v", userIDAny), nil)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *contactRow) {
+		if !revealed[r.ID] {
+			r.mask()
+		}
+	}, nil
+}
+
+// revealedIDs returns which of ids the user has paid to reveal; a nil ids
+// slice returns all of them.
+func (h *Handlers) revealedIDs(ctx context.Context, userID string, ids []uint64) (map[uint64]bool, error) {
+	var keys []string
+	if ids != nil {
+		keys = make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = strconv.FormatUint(id, 10)
+		}
+	}
+	rows, err := h.pg.Query(ctx, `SELECT contact_id FROM user_contact_reveals WHERE user_id=$1 AND ($2::text[] IS NULL OR contact_id = ANY($2))`, userID, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[uint64]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if id, err := strconv.ParseUint(key, 10, 64); err == nil {
+			out[id] = true
+		}
+	}
+	return out, rows.Err()
+}
+
+type revealRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// RevealContacts unmasks the given contacts for the user, charging one reveal
+// credit for each contact not revealed before. Either every new contact is
+// paid for or none are.
+func (h *Handlers) RevealContacts(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	var in revealRequest
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if len(in.IDs) == 0 || len(in.IDs) > maxRevealIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("between 1 and %d ids required", maxRevealIDs)})
+		return
+	}
+	args := make([]any, len(in.IDs))
+	for i, s := range in.IDs {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id " + s})
+			return
+		}
+		args[i] = id
+	}
+
+	ckCtx, ckCancel := context.WithTimeout(c.Request.Context(), requestTimeout(c, 20*time.Second))
+	defer ckCancel()
+	rows, err := h.ck.Query(ckCtx, fmt.Sprintf(`SELECT %s FROM contacts WHERE id IN (%s) LIMIT 1 BY id`, contactColumns, placeholders(len(args))), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var found []contactRow
+	for rows.Next() {
+		r, err := scanContact(rows)
+		if err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		found = append(found, r)
+	}
+	rows.Close()
+	if len(found) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "contacts not found"})
+		return
+	}
+
+	keys := make([]string, len(found))
+	for i, r := range found {
+		keys[i] = strconv.FormatUint(r.ID, 10)
+	}
+	charged, remaining, err := h.chargeReveals(c.Request.Context(), userID, keys)
+	if errors.Is(err, errNoRevealCredits) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "not enough reveal credits", "required": charged})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rows": found, "charged": charged, "reveal_credits": remaining})
+}
+
+var errNoRevealCredits = errors.New("not enough reveal credits")
+
+// chargeReveals records the user's reveals of the contact ids and charges one
+// credit per id not revealed before, in one transaction. Only the rows the
+// insert actually added are charged, so concurrent reveals of the same
+// contact pay once. It returns the number charged and the credits left; on
+// errNoRevealCredits nothing is recorded and charged is the number required.
+func (h *Handlers) chargeReveals(ctx context.Context, userID string, ids []string) (charged, remaining int, err error) {
+	tx, err := h.pg.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(context.Background())
+	rows, err := tx.Query(ctx, `INSERT INTO user_contact_reveals (user_id, contact_id) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING RETURNING contact_id`, userID, ids)
+	if err != nil {
+		return 0, 0, err
+	}
+	for rows.Next() {
+		charged++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	err = tx.QueryRow(ctx, `UPDATE users SET reveal_credits = reveal_credits - $2 WHERE id=$1 AND reveal_credits >= $2 RETURNING reveal_credits`, userID, charged).Scan(&remaining)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return charged, 0, errNoRevealCredits
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return charged, remaining, tx.Commit(ctx)
+}
@@ -57,9 +57,29 @@ func Router(pg *pgxpool.Pool, ck ch.Conn) *gin.Engine {
 		auth.GET("/auth/me", h.Me)
 		// Protected search with quota tracking is inside Search handler using context
 		auth.POST("/search", h.Search)
+		auth.POST("/search/export", h.ExportSearch)
+		auth.POST("/search/facets", h.SearchFacets)
+		auth.GET("/search/suggest", RateLimitMiddleware(newRateLimiter(getIntEnv("SUGGEST_RATE_LIMIT", 60), time.Minute)), h.SuggestValues)
+		auth.GET("/companies/:domain", h.GetCompany)
+		auth.GET("/contacts/:id", h.GetContact)
+		auth.POST("/contacts/reveal", h.RevealContacts)
 		// history endpoints (to be implemented fully)
 		auth.GET("/user/history", h.UserHistory)
 		auth.GET("/user/last-search", h.UserLastSearch)
+		// saved searches
+		auth.GET("/user/saved-searches", h.ListSavedSearches)
+		auth.POST("/user/saved-searches", h.CreateSavedSearch)
+		auth.GET("/user/saved-searches/:id", h.GetSavedSearch)
+		auth.PUT("/user/saved-searches/:id", h.UpdateSavedSearch)
+		auth.DELETE("/user/saved-searches/:id", h.DeleteSavedSearch)
+		auth.POST("/user/saved-searches/:id/run", h.RunSavedSearch)
+		// alerts on new uploads
+		auth.GET("/user/alerts", h.ListSearchAlerts)
+		auth.POST("/user/alerts", h.CreateSearchAlert)
+		auth.PUT("/user/alerts/:id", h.UpdateSearchAlert)
+		auth.DELETE("/user/alerts/:id", h.DeleteSearchAlert)
+		auth.GET("/user/alert-notifications", h.ListAlertNotifications)
+		auth.POST("/user/alert-notifications/:id/read", h.MarkAlertNotificationRead)
 	}
 
 	// Admin routes
@@ -77,6 +97,7 @@ func Router(pg *pgxpool.Pool, ck ch.Conn) *gin.Engine {
 		admin.GET("/registration-requests", h.ListRegistrationRequests)
 		admin.PUT("/registration-requests/:id", h.UpdateRegistrationRequest)
 		admin.GET("/users/:id/searches", h.AdminUserSearches)
+		admin.POST("/search/explain", h.ExplainSearch)
 	}
 
 	return r
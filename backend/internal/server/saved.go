@@ -0,0 +1,241 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type savedSearchInput struct {
+	Name   *string        `json:"name"`
+	Params *searchRequest `json:"params"`
+}
+
+// validateSearchRequest reports whether req would be accepted by Search, so
+// bad queries are rejected when saved rather than when re-run.
+func validateSearchRequest(req searchRequest) error {
+	if _, _, err := compileSearch(req); err != nil {
+		return err
+	}
+	if _, err := parseFields(req.Fields); err != nil {
+		return err
+	}
+	_, err := resultOrder(req)
+	return err
+}
+
+// savedParams strips paging state from a request before it is stored; runs
+// always start from the first page unless the caller asks otherwise.
+func savedParams(req searchRequest) searchRequest {
+	req.Page = 0
+	req.Cursor = ""
+	return req
+}
+
+func (h *Handlers) ListSavedSearches(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	rows, err := h.pg.Query(c, `SELECT id::text, name, params::text, last_run_at, created_at, updated_at FROM user_saved_searches WHERE user_id=$1 ORDER BY updated_at DESC LIMIT 200`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	list := []gin.H{}
+	for rows.Next() {
+		var id, name, params string
+		var lastRunAt *time.Time
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&id, &name, &params, &lastRunAt, &createdAt, &updatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list = append(list, gin.H{"id": id, "name": name, "params": jsonText(params), "last_run_at": lastRunAt, "created_at": createdAt, "updated_at": updatedAt})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": list})
+}
+
+func (h *Handlers) GetSavedSearch(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var name, params string
+	var lastRunAt *time.Time
+	var createdAt, updatedAt time.Time
+	err = h.pg.QueryRow(c, `SELECT name, params::text, last_run_at, created_at, updated_at FROM user_saved_searches WHERE id=$1 AND user_id=$2`, id, userID).Scan(&name, &params, &lastRunAt, &createdAt, &updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "saved search not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id.String(), "name": name, "params": jsonText(params), "last_run_at": lastRunAt, "created_at": createdAt, "updated_at": updatedAt})
+}
+
+func (h *Handlers) CreateSavedSearch(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	var in savedSearchInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if in.Name == nil || strings.TrimSpace(*in.Name) == "" || in.Params == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and params required"})
+		return
+	}
+	if err := validateSearchRequest(*in.Params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var id string
+	err := h.pg.QueryRow(c, `INSERT INTO user_saved_searches (user_id, name, params) VALUES ($1,$2,$3)
+		ON CONFLICT (user_id, name) DO NOTHING
+		RETURNING id::text`, userID, strings.TrimSpace(*in.Name), toJSON(savedParams(*in.Params))).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a saved search with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save search"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (h *Handlers) UpdateSavedSearch(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var in savedSearchInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	// Build dynamic UPDATE
+	set := []string{}
+	args := []any{}
+	idx := 1
+	if in.Name != nil {
+		if strings.TrimSpace(*in.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+		set = append(set, "name = $"+itoa(idx))
+		args = append(args, strings.TrimSpace(*in.Name))
+		idx++
+	}
+	if in.Params != nil {
+		if err := validateSearchRequest(*in.Params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set = append(set, "params = $"+itoa(idx))
+		args = append(args, toJSON(savedParams(*in.Params)))
+		idx++
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+	args = append(args, id, userID)
+	query := "UPDATE user_saved_searches SET " + strings.Join(set, ", ") + " WHERE id = $" + itoa(idx) + " AND user_id = $" + itoa(idx+1)
+	res, err := h.pg.Exec(c, query, args...)
+	// a rename onto another saved search's name violates UNIQUE (user_id, name)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "a saved search with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "saved search not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (h *Handlers) DeleteSavedSearch(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	res, err := h.pg.Exec(c, `DELETE FROM user_saved_searches WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete saved search"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "saved search not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// RunSavedSearch re-runs a saved search through the regular Search path, so
+// it is cached, logged and charged like any other search. The page, pageSize
+// and cursor query parameters page through the results.
+func (h *Handlers) RunSavedSearch(c *gin.Context) {
+	uidAny, _ := c.Get("user_id")
+	userID := fmt.Sprintf("%v", uidAny)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	// only the start of a run counts as running it, not fetching later pages
+	page := c.Query("page")
+	cursor := c.Query("cursor")
+	query := `SELECT params FROM user_saved_searches WHERE id=$1 AND user_id=$2`
+	if n, _ := strconv.Atoi(page); cursor == "" && n <= 1 {
+		query = `UPDATE user_saved_searches SET last_run_at=now() WHERE id=$1 AND user_id=$2 RETURNING params`
+	}
+	var params []byte
+	err = h.pg.QueryRow(c, query, id, userID).Scan(&params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "saved search not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var req searchRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "stored search is unreadable"})
+		return
+	}
+	if page != "" {
+		req.Page, _ = strconv.Atoi(page)
+	}
+	if v := c.Query("pageSize"); v != "" {
+		req.PageSize, _ = strconv.Atoi(v)
+	}
+	req.Cursor = cursor
+	h.runSearch(c, req)
+}
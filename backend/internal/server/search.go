@@ -3,12 +3,17 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 )
 
 type searchRequest struct {
@@ -26,7 +31,68 @@ type searchRequest struct {
 	Domain              string `json:"domain"`
 	Facebook            string `json:"facebook"`
 	LinkedinCompanyPage string `json:"linkedinCompanyPage"`
-	// Country and State are intentionally omitted from filters for this app
+	// Q is free text matched word by word against name, email, company,
+	// position, domain and LinkedIn; every word must appear in one of them.
+	Q string `json:"q"`
+
+	// Countries and States restrict results to a region (IN semantics) and
+	// are ANDed with the other filters regardless of Logic.
+	Countries []string `json:"countries"`
+	States    []string `json:"states"`
+	// FileIDs restricts results to contacts from these uploads.
+	FileIDs []uint64 `json:"fileIds"`
+	// IngestedFrom and IngestedTo bound when contacts were ingested, as
+	// RFC 3339 timestamps or YYYY-MM-DD dates in IST. Both are inclusive; a
+	// date as IngestedTo includes that whole day.
+	IngestedFrom string `json:"ingestedFrom"`
+	IngestedTo   string `json:"ingestedTo"`
+	// NormalizeCountries expands ISO codes and names in Countries to every
+	// known spelling, so "US" also matches "United States" and "USA".
+	NormalizeCountries bool `json:"normalizeCountries"`
+	// EmailDomains restricts results to emails at exactly these domains
+	// ("@acme.com" or "acme.com"), so subdomains and lookalikes don't match.
+	EmailDomains []string `json:"emailDomains"`
+	// EmailType is "work" for corporate addresses or "personal" for
+	// free-mail providers such as gmail.com; empty matches both.
+	EmailType string `json:"emailType"`
+	// Seniorities and Departments match the classification ingest derives
+	// from position, e.g. "director" and "finance" (see title_rules.json).
+	Seniorities []string `json:"seniorities"`
+	Departments []string `json:"departments"`
+
+	// SinceLastRun returns only contacts ingested since this user last ran
+	// the same filters; the response's since says when that was. Later
+	// pages are read with nextCursor, which keeps that cutoff. Only Search
+	// and saved search runs accept it.
+	SinceLastRun bool `json:"sinceLastRun"`
+
+	// Dedupe collapses contacts of the same person across uploads into one
+	// merged row, and total counts people instead of rows.
+	Dedupe bool `json:"dedupe"`
+
+	// Match selects a match mode per field name (contains, exact, prefix,
+	// suffix or regex); fields not listed use contains.
+	Match map[string]string `json:"match"`
+
+	// Query is an optional nested boolean filter, ANDed with the fields above.
+	Query *queryNode `json:"query"`
+
+	// Exclude drops contacts matching any of these conditions, regardless
+	// of Logic.
+	Exclude []excludeFilter `json:"exclude"`
+
+	// Sort orders results by up to five keys, including "relevance". The
+	// default is most relevant first when flat fields or q are given and
+	// newest first otherwise.
+	Sort []sortKey `json:"sort"`
+
+	// Cursor is the nextCursor of a previous page; when set it replaces Page
+	// and the next page is read by seeking instead of OFFSET.
+	Cursor string `json:"cursor"`
+
+	// Fields limits each returned row to these contactRow fields (JSON
+	// names); empty returns every field.
+	Fields []string `json:"fields"`
 }
 
 type contactRow struct {
@@ -44,9 +110,34 @@ type contactRow struct {
 	LinkedinCompanyPage string `json:"linkedinCompanyPage"`
 	Country             string `json:"country"`
 	State               string `json:"state"`
+	Seniority           string `json:"seniority"`
+	Department          string `json:"department"`
+	FileID              uint64 `json:"fileId"`
+	// SourceFile is the original filename of the upload the row came from.
+	SourceFile string `json:"sourceFile,omitempty"`
+	// ID is the stable contact id, serialized as a string since uint64 does
+	// not fit in a JSON number.
+	ID uint64 `json:"id,string"`
+	// Masked is set when email and phone numbers have been masked.
+	Masked bool `json:"masked,omitempty"`
+	// Score is the row's relevance when results are ordered by it.
+	Score uint64 `json:"score,omitempty"`
+	// Highlights holds where the flat fields and q matched, per field.
+	Highlights map[string][]matchRange `json:"highlights,omitempty"`
 }
 
 func (h *Handlers) Search(c *gin.Context) {
+	var req searchRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	h.runSearch(c, req)
+}
+
+// runSearch executes a search for the authenticated user and writes the
+// response: cache lookup, quota check, data and count queries, logging.
+func (h *Handlers) runSearch(c *gin.Context, req searchRequest) {
 	// quota check
 	userIDAny, exists := c.Get("user_id")
 	if !exists {
@@ -59,15 +150,6 @@ func (h *Handlers) Search(c *gin.Context) {
 	ip := c.ClientIP()
 	ua := c.Request.UserAgent()
 
-	var req searchRequest
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-		return
-	}
-	logic := strings.ToUpper(strings.TrimSpace(req.Logic))
-	if logic != "OR" {
-		logic = "AND"
-	}
 	page := req.Page
 	if page < 1 {
 		page = 1
@@ -77,57 +159,140 @@ func (h *Handlers) Search(c *gin.Context) {
 		size = 100 // Changed from 25 to 100 for better UX
 	}
 	offset := (page - 1) * size
+	where, args, err := compileSearch(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := resultOrder(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	proj, err := parseFields(req.Fields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ndjson := wantsNDJSON(c)
+	sortSig := sortSignature(req.Sort)
+	var cursor *searchCursor
+	if req.Cursor != "" {
+		sc, err := decodeCursor(req.Cursor, order, sortSig)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cursor = &sc
+		page, offset = 0, 0
+	}
+	qk := queryKey(req)
+	firstPage := page == 1 && cursor == nil
+
+	// The cutoff is looked up on a run's first page, before the run is
+	// logged, and carried in its cursors from there.
+	var since *time.Time
+	if req.SinceLastRun {
+		switch {
+		case cursor != nil:
+			if cursor.Since != 0 {
+				at := time.Unix(cursor.Since, 0)
+				since = &at
+			}
+		case !firstPage:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sinceLastRun pages are read with nextCursor"})
+			return
+		default:
+			if since, err = h.previousRun(c.Request.Context(), userID, qk); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed search history"})
+				return
+			}
+		}
+		if since != nil {
+			where = andWhere(where, "created_at >= toDateTime(?)")
+			args = append(args, since.Unix())
+		}
+	}
+
+	// Only a run's first page records the query as run
+	var runKey *string
+	if firstPage {
+		runKey = &qk
+	}
 
 	// Build normalized key (trimmed, lower-cased where applicable)
-	norm := func(s string) string { return strings.TrimSpace(strings.ToLower(s)) }
-	normalizedKey := fmt.Sprintf("logic=%s|name=%s|email=%s|phone=%s|linkedin=%s|position=%s|company=%s|companyPhone=%s|website=%s|domain=%s|facebook=%s|linkedinCompanyPage=%s|page=%d|size=%d",
-		logic, norm(req.Name), norm(req.Email), norm(req.Phone), norm(req.Linkedin), norm(req.Position), norm(req.Company), norm(req.CompanyPhone), norm(req.Website), norm(req.Domain), norm(req.Facebook), norm(req.LinkedinCompanyPage), page, size,
-	)
+	normalizedKey := fmt.Sprintf("%s|page=%d|size=%d", qk, page, size)
+	if since != nil {
+		normalizedKey += fmt.Sprintf("|since=%d", since.Unix())
+	}
+	if sortSig != "" {
+		normalizedKey += "|sort=" + sortSig
+	}
+	if cursor != nil {
+		normalizedKey += "|cursor=" + req.Cursor
+	}
 
 	// Check device cache (per device last-search, only a single entry per device)
 	var cachedSnapshot []byte
 	var cachedTotal int64
-	_ = h.pg.QueryRow(c.Request.Context(), `SELECT snapshot, total_results FROM user_device_search_cache WHERE user_id=$1 AND device_fingerprint=$2 AND normalized_key=$3`, userID, fingerprint, normalizedKey).Scan(&cachedSnapshot, &cachedTotal)
+	var cachedNext string
+	_ = h.pg.QueryRow(c.Request.Context(), `SELECT snapshot, total_results, COALESCE(next_cursor,'') FROM user_device_search_cache WHERE user_id=$1 AND device_fingerprint=$2 AND normalized_key=$3`, userID, fingerprint, normalizedKey).Scan(&cachedSnapshot, &cachedTotal, &cachedNext)
 	if cachedSnapshot != nil && cachedTotal > 0 {
 		var out []contactRow
 		_ = json.Unmarshal(cachedSnapshot, &out)
-		c.JSON(http.StatusOK, gin.H{"rows": out, "total": cachedTotal})
+		out = h.maskRows(c, out)
+		if ndjson {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			for i := range out {
+				writeNDJSONLine(c, proj.encode(&out[i]))
+			}
+			writeNDJSONLine(c, toJSON(gin.H{"total": cachedTotal, "nextCursor": cachedNext, "since": since}))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rows": proj.rows(out), "total": cachedTotal, "nextCursor": cachedNext, "since": since})
 		return
 	}
 
 	// Enforce daily limit based on IST midnight window
-	ist, _ := time.LoadLocation("Asia/Kolkata")
-	nowIST := time.Now().In(ist)
-	var limit int
-	if err := h.pg.QueryRow(c.Request.Context(), `SELECT daily_search_limit FROM users WHERE id = $1`, userID).Scan(&limit); err != nil {
+	usageDate := istUsageDate()
+	exceeded, err := h.quotaExceeded(c.Request.Context(), userID, usageDate)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed quota"})
 		return
 	}
-	var used int
-	_ = h.pg.QueryRow(c.Request.Context(), `SELECT search_count FROM user_daily_usage WHERE user_id = $1 AND usage_date = $2`, userID, nowIST.Format("2006-01-02")).Scan(&used)
-	if used >= limit {
+	if exceeded {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "daily search limit reached"})
 		return
 	}
 
-	where, args := buildWhere(req, logic)
-	if where == "" {
-		where = "1"
+	from, dataWhere := contactSource(req.Dedupe, where)
+	dataArgs := args
+	if cursor != nil {
+		cw, cargs := cursorWhere(order, *cursor)
+		dataWhere = dataWhere + " AND " + cw
+		dataArgs = append(append([]any{}, args...), cargs...)
 	}
 
-	// Request-scoped timeout for ClickHouse queries
-	ckTimeout := 20 * time.Second // Increased from 15s to 20s
-	if s := strings.TrimSpace(c.Request.Header.Get("X-CH-Timeout")); s != "" {
-		if d, err := time.ParseDuration(s); err == nil {
-			ckTimeout = d
-		}
+	if ndjson {
+		h.streamSearch(c, req, searchStream{
+			dataQuery: searchDataQuery(from, dataWhere, order, size, offset), dataArgs: dataArgs,
+			countQuery: countQuery(req.Dedupe, where), countArgs: args,
+			proj: proj, order: order, sortSig: sortSig, size: size,
+			normalizedKey: normalizedKey, runKey: runKey, usageDate: usageDate, since: since,
+		})
+		return
 	}
+
+	// Request-scoped timeout for ClickHouse queries
+	ckTimeout := requestTimeout(c, 20*time.Second) // Increased from 15s to 20s
 	ckCtx, ckCancel := context.WithTimeout(c.Request.Context(), ckTimeout)
 	defer ckCancel()
 
 	// Execute data query and count query in parallel for better performance
 	type dataResult struct {
 		rows []contactRow
+		next string
 		err  error
 	}
 	type countResult struct {
@@ -139,38 +304,40 @@ func (h *Handlers) Search(c *gin.Context) {
 
 	// Fetch data rows
 	go func() {
-		// Query with SETTINGS for better performance on large datasets
-		query := fmt.Sprintf(`SELECT name, email, phone, linkedin, position, company, company_phone, website, domain, facebook, twitter, linkedin_company_page, country, state
-			FROM contacts
-			WHERE %s
-			ORDER BY created_at DESC
-			LIMIT %d OFFSET %d
-			SETTINGS max_threads = 4`, where, size, offset)
-		rows, err := h.ck.Query(ckCtx, query, args...)
+		query := searchDataQuery(from, dataWhere, order, size, offset)
+		rows, err := h.ck.Query(ckCtx, query, dataArgs...)
 		if err != nil {
 			dataChan <- dataResult{err: err}
 			return
 		}
 
 		var out []contactRow
+		last := newCursor(sortSig, since)
+		lastDest := cursorDest(order, &last)
 		for rows.Next() {
-			var r contactRow
-			if err := rows.Scan(&r.Name, &r.Email, &r.Phone, &r.Linkedin, &r.Position, &r.Company, &r.CompanyPhone, &r.Website, &r.Domain, &r.Facebook, &r.Twitter, &r.LinkedinCompanyPage, &r.Country, &r.State); err != nil {
+			r, err := scanContact(rows, lastDest...)
+			if err != nil {
 				rows.Close()
 				dataChan <- dataResult{err: err}
 				return
 			}
+			r.Score = last.Score
 			out = append(out, r)
 		}
 		rows.Close()
-		dataChan <- dataResult{rows: out, err: nil}
+		// A full page may have more rows behind it; hand out where it ended.
+		var next string
+		if len(out) == size {
+			next = last.encode()
+		}
+		dataChan <- dataResult{rows: out, next: next, err: nil}
 	}()
 
 	// Fetch count in parallel
 	go func() {
 		countCtx, countCancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer countCancel()
-		totalQ := fmt.Sprintf(`SELECT count() FROM contacts WHERE %s`, where)
+		totalQ := countQuery(req.Dedupe, where)
 		var total uint64
 		if err := h.ck.QueryRow(countCtx, totalQ, args...).Scan(&total); err != nil {
 			countChan <- countResult{err: err}
@@ -194,62 +361,581 @@ func (h *Handlers) Search(c *gin.Context) {
 
 	out := dataRes.rows
 	total := countRes.total
+	next := dataRes.next
+	h.attachSourceFiles(c.Request.Context(), out)
+	newHighlighter(req).highlight(out)
 
-	// Log search and update cache; decrement count only if results>0 and not from cache
+	// Log search and update cache; decrement count only if results>0 and not from cache.
+	// Snapshots keep full rows; masking is applied whenever they are served.
 	snap, _ := json.Marshal(out)
 	paramsJSON := toJSON(req)
-	_, _ = h.pg.Exec(c.Request.Context(), `INSERT INTO user_search_logs (user_id, device_fingerprint, ip_address, user_agent, params, normalized_key, total_results, snapshot)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`, userID, fingerprint, ip, ua, paramsJSON, normalizedKey, int64(total), snap)
+	_, _ = h.pg.Exec(c.Request.Context(), `INSERT INTO user_search_logs (user_id, device_fingerprint, ip_address, user_agent, params, normalized_key, total_results, snapshot, query_key)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`, userID, fingerprint, ip, ua, paramsJSON, normalizedKey, int64(total), snap, runKey)
 	// Cache last search per device (replace)
-	_, _ = h.pg.Exec(c.Request.Context(), `INSERT INTO user_device_search_cache (user_id, device_fingerprint, normalized_key, snapshot, total_results, params, created_at)
-		VALUES ($1,$2,$3,$4,$5,$6,now())
-		ON CONFLICT (user_id, device_fingerprint) DO UPDATE SET normalized_key=EXCLUDED.normalized_key, snapshot=EXCLUDED.snapshot, total_results=EXCLUDED.total_results, params=EXCLUDED.params, created_at=now()`, userID, fingerprint, normalizedKey, snap, int64(total), paramsJSON)
+	_, _ = h.pg.Exec(c.Request.Context(), `INSERT INTO user_device_search_cache (user_id, device_fingerprint, normalized_key, snapshot, total_results, params, next_cursor, created_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,now())
+		ON CONFLICT (user_id, device_fingerprint) DO UPDATE SET normalized_key=EXCLUDED.normalized_key, snapshot=EXCLUDED.snapshot, total_results=EXCLUDED.total_results, params=EXCLUDED.params, next_cursor=EXCLUDED.next_cursor, created_at=now()`, userID, fingerprint, normalizedKey, snap, int64(total), paramsJSON, next)
 	if total > 0 {
-		_, _ = h.pg.Exec(c.Request.Context(), `INSERT INTO user_daily_usage (user_id, usage_date, search_count) VALUES ($1,$2,1)
-			ON CONFLICT (user_id, usage_date) DO UPDATE SET search_count = user_daily_usage.search_count + 1`, userID, nowIST.Format("2006-01-02"))
+		h.chargeSearch(c.Request.Context(), userID, usageDate)
+	}
+
+	resp := gin.H{"rows": proj.rows(h.maskRows(c, out)), "total": total, "nextCursor": next, "since": since}
+	if total == 0 {
+		if alt := h.didYouMean(c.Request.Context(), req); alt != nil {
+			resp["didYouMean"] = alt
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// searchOnly rejects options only Search supports, writing a 400 and
+// returning false. sinceLastRun is relative to the run Search logs, which
+// facets, explains and exports of the same filters would find as the last
+// run and so match nothing.
+func searchOnly(c *gin.Context, req searchRequest) bool {
+	if req.SinceLastRun {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sinceLastRun is only supported by search"})
+		return false
+	}
+	return true
+}
+
+// previousRun returns when the user last ran the filters identified by
+// queryKey, or nil if they never did.
+func (h *Handlers) previousRun(ctx context.Context, userID, queryKey string) (*time.Time, error) {
+	var at time.Time
+	err := h.pg.QueryRow(ctx, `SELECT created_at FROM user_search_logs WHERE user_id=$1 AND query_key=$2 ORDER BY created_at DESC LIMIT 1`, userID, queryKey).Scan(&at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+
+// searchDataQuery is the query runSearch reads a page of results with; from
+// and where come from contactSource.
+func searchDataQuery(from, where string, order []orderKey, size, offset int) string {
+	// Query with SETTINGS for better performance on large datasets
+	return fmt.Sprintf(`SELECT %s, %s
+		FROM %s
+		WHERE %s
+		ORDER BY %s
+		LIMIT %d OFFSET %d
+		SETTINGS max_threads = 4`, contactColumns, orderSelect(order), from, where, orderByClause(order), size, offset)
+}
+
+// contactColumns is the column list every contact query selects; scanContact
+// reads it back in the same order.
+const contactColumns = `name, email, phone, linkedin, position, company, company_phone, website, domain, facebook, twitter, linkedin_company_page, country, state, seniority, department, file_id, id`
+
+// Any columns selected after contactColumns are scanned into extra.
+func scanContact(rows driver.Rows, extra ...any) (contactRow, error) {
+	var r contactRow
+	dest := []any{&r.Name, &r.Email, &r.Phone, &r.Linkedin, &r.Position, &r.Company, &r.CompanyPhone, &r.Website, &r.Domain, &r.Facebook, &r.Twitter, &r.LinkedinCompanyPage, &r.Country, &r.State, &r.Seniority, &r.Department, &r.FileID, &r.ID}
+	err := rows.Scan(append(dest, extra...)...)
+	return r, err
+}
+
+// queryKey is the normalized (trimmed, lower-cased) form of the filters in a
+// request, without pagination. Search appends page/size to build its cache key.
+func queryKey(req searchRequest) string {
+	norm := func(field, s string) string { return normKeyValue(req.Match[field], s) }
+	key := fmt.Sprintf("logic=%s|name=%s|email=%s|phone=%s|linkedin=%s|position=%s|company=%s|companyPhone=%s|website=%s|domain=%s|facebook=%s|linkedinCompanyPage=%s",
+		searchLogic(req), norm("name", req.Name), norm("email", req.Email), norm("phone", req.Phone), norm("linkedin", req.Linkedin), norm("position", req.Position), norm("company", req.Company), norm("companyPhone", req.CompanyPhone), norm("website", req.Website), norm("domain", req.Domain), norm("facebook", req.Facebook), norm("linkedinCompanyPage", req.LinkedinCompanyPage),
+	)
+	if len(req.Match) > 0 {
+		modes := make([]string, 0, len(req.Match))
+		for field, mode := range req.Match {
+			if m, _ := normMatchMode(mode); m != matchContains {
+				modes = append(modes, field+":"+m)
+			}
+		}
+		sort.Strings(modes)
+		key += "|match=" + strings.Join(modes, ",")
+	}
+	if req.Query != nil {
+		key += "|query=" + req.Query.key()
+	}
+	if tokens := searchTokens(req.Q); len(tokens) > 0 {
+		key += "|q=" + strings.Join(tokens, " ")
+	}
+	if len(req.Exclude) > 0 {
+		key += "|exclude=" + excludeKey(req.Exclude)
+	}
+	if len(req.FileIDs) > 0 {
+		ids := append([]uint64(nil), req.FileIDs...)
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		key += fmt.Sprintf("|fileIds=%v", ids)
+	}
+	if req.IngestedFrom != "" || req.IngestedTo != "" {
+		// bounds are validated by buildWhere before any key is built
+		from, _ := parseIngestedBound(req.IngestedFrom, false)
+		to, _ := parseIngestedBound(req.IngestedTo, true)
+		key += fmt.Sprintf("|ingested=%d..%d", from.Unix(), to.Unix())
+	}
+	if len(req.Countries) > 0 {
+		key += fmt.Sprintf("|countries=%s|normalizeCountries=%t", normList(req.Countries), req.NormalizeCountries)
 	}
+	if len(req.States) > 0 {
+		key += "|states=" + normList(req.States)
+	}
+	if len(req.EmailDomains) > 0 {
+		key += "|emailDomains=" + normList(emailDomains(req.EmailDomains))
+	}
+	if t := strings.ToLower(strings.TrimSpace(req.EmailType)); t != "" {
+		key += "|emailType=" + t
+	}
+	if len(req.Seniorities) > 0 {
+		key += "|seniorities=" + normList(req.Seniorities)
+	}
+	if len(req.Departments) > 0 {
+		key += "|departments=" + normList(req.Departments)
+	}
+	if req.Dedupe {
+		key += "|dedupe=true"
+	}
+	return key
+}
 
-	c.JSON(http.StatusOK, gin.H{"rows": out, "total": total})
+// normKeyValue normalizes a filter value for cache keys. Regex patterns keep
+// their case since it is significant in escapes such as \D versus \d.
+func normKeyValue(mode, s string) string {
+	if m, _ := normMatchMode(mode); m == matchRegex {
+		return strings.TrimSpace(s)
+	}
+	return strings.TrimSpace(strings.ToLower(s))
+}
+
+// requestTimeout returns the ClickHouse timeout for a request, honouring the
+// X-CH-Timeout header (a Go duration such as "45s") when present.
+func requestTimeout(c *gin.Context, d time.Duration) time.Duration {
+	if s := strings.TrimSpace(c.Request.Header.Get("X-CH-Timeout")); s != "" {
+		if v, err := time.ParseDuration(s); err == nil {
+			return v
+		}
+	}
+	return d
+}
+
+// istUsageDate returns today's date in the IST midnight window daily quotas reset on.
+func istUsageDate() string {
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	return time.Now().In(ist).Format("2006-01-02")
+}
+
+// quotaExceeded reports whether the user has used up their daily search limit.
+func (h *Handlers) quotaExceeded(ctx context.Context, userID, usageDate string) (bool, error) {
+	var limit int
+	if err := h.pg.QueryRow(ctx, `SELECT daily_search_limit FROM users WHERE id = $1`, userID).Scan(&limit); err != nil {
+		return false, err
+	}
+	var used int
+	_ = h.pg.QueryRow(ctx, `SELECT search_count FROM user_daily_usage WHERE user_id = $1 AND usage_date = $2`, userID, usageDate).Scan(&used)
+	return used >= limit, nil
+}
+
+// chargeSearch counts one search against the user's daily quota.
+func (h *Handlers) chargeSearch(ctx context.Context, userID, usageDate string) {
+	_, _ = h.pg.Exec(ctx, `INSERT INTO user_daily_usage (user_id, usage_date, search_count) VALUES ($1,$2,1)
+		ON CONFLICT (user_id, usage_date) DO UPDATE SET search_count = user_daily_usage.search_count + 1`, userID, usageDate)
+}
+
+// searchField describes how a filterable request field is matched.
+type searchField struct {
+	expr  string // column expression the value is matched against
+	phone bool   // an E.164 column, see phoneCondition
+}
+
+// searchFields maps request field names (their JSON names) to columns.
+// Use lowercased materialized columns for LIKE to benefit from ngram bloom filter indexes
+// This provides fast substring matching even on large datasets
+var searchFields = map[string]searchField{
+	"name":                {expr: "name_lc"},
+	"email":               {expr: "email_lc"},
+	"phone":               {expr: "phone_e164", phone: true},
+	"linkedin":            {expr: "linkedin_lc"},
+	"position":            {expr: "position_lc"},
+	"company":             {expr: "company_lc"},
+	"companyPhone":        {expr: "company_phone_e164", phone: true},
+	"website":             {expr: "website_lc"},
+	"domain":              {expr: "domain_lc"},
+	"facebook":            {expr: "facebook_lc"},
+	"linkedinCompanyPage": {expr: "linkedin_company_page_lc"},
+	"emailDomain":         {expr: "email_domain_lc"},
+}
+
+// Match modes a field filter can use. contains is the default.
+const (
+	matchContains = "contains"
+	matchExact    = "exact"
+	matchPrefix   = "prefix"
+	matchSuffix   = "suffix"
+	matchRegex    = "regex"
+)
+
+// maxRegexLen bounds regex filters; ClickHouse uses RE2 like Go, so any
+// pattern Go accepts runs in linear time there too.
+const maxRegexLen = 128
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// normMatchMode validates a match mode, defaulting empty to contains.
+func normMatchMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return matchContains, nil
+	case matchContains, matchExact, matchPrefix, matchSuffix, matchRegex:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w: unknown match mode %q", errInvalidQuery, mode)
+}
+
+// fieldCondition compiles a filter on one field using the given match mode,
+// picking the form ClickHouse can check against the ngram bloom filter
+// indexes. expr is empty when the value is empty and the field should not
+// constrain the search.
+func fieldCondition(field, mode, val string) (expr string, args []any, err error) {
+	f := searchFields[field]
+	if mode, err = normMatchMode(mode); err != nil {
+		return "", nil, err
+	}
+	if f.phone && mode != matchRegex {
+		return phoneCondition(f.expr, mode, val)
+	}
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return "", nil, nil
+	}
+	switch mode {
+	case matchExact:
+		return f.expr + " = ?", []any{strings.ToLower(val)}, nil
+	case matchPrefix:
+		return "startsWith(" + f.expr + ", ?)", []any{strings.ToLower(val)}, nil
+	case matchSuffix:
+		// accept wildcard style suffixes such as *.co.uk
+		val = strings.TrimLeft(val, "*")
+		if val == "" {
+			return "", nil, nil
+		}
+		return "endsWith(" + f.expr + ", ?)", []any{strings.ToLower(val)}, nil
+	case matchRegex:
+		if len(val) > maxRegexLen {
+			return "", nil, fmt.Errorf("%w: %s regex longer than %d characters", errInvalidQuery, field, maxRegexLen)
+		}
+		if _, err := regexp.Compile(val); err != nil {
+			return "", nil, fmt.Errorf("%w: %s regex: %v", errInvalidQuery, field, err)
+		}
+		// columns are lower-cased, so match case-insensitively rather than
+		// lower-casing the pattern (which would break classes such as \D)
+		return "match(" + f.expr + ", ?)", []any{"(?i)" + val}, nil
+	}
+	return f.expr + " LIKE ?", []any{"%" + likeEscaper.Replace(strings.ToLower(val)) + "%"}, nil
+}
+
+// phoneCondition matches a phone however the user wrote it. Numbers given
+// with a country code are compared against the whole E.164 value; national
+// numbers are compared against its tail, since the country code they omit
+// is unknown, so prefix matching anchors only international numbers. Rows
+// ingested before normalization hold bare digits, so international numbers
+// also match those without the +.
+func phoneCondition(expr, mode, val string) (string, []any, error) {
+	key, international := phoneSearchKey(val)
+	if key == "" {
+		return "", nil, nil
+	}
+	switch {
+	case mode == matchExact && international:
+		return expr + " IN (?, ?)", []any{"+" + key, key}, nil
+	case mode == matchExact, mode == matchSuffix:
+		return "endsWith(" + expr + ", ?)", []any{key}, nil
+	case mode == matchPrefix && international:
+		return "(startsWith(" + expr + ", ?) OR startsWith(" + expr + ", ?))", []any{"+" + key, key}, nil
+	}
+	return expr + " LIKE ?", []any{"%" + key + "%"}, nil
+}
+
+// fieldFilter is one of a request's flat field filters, by JSON name.
+type fieldFilter struct {
+	field string
+	val   string
+}
+
+// fieldFilters lists the flat fields of req, in the order they are compiled.
+func (req searchRequest) fieldFilters() []fieldFilter {
+	return []fieldFilter{
+		{"name", req.Name},
+		{"email", req.Email},
+		{"phone", req.Phone},
+		{"linkedin", req.Linkedin},
+		{"position", req.Position},
+		{"company", req.Company},
+		{"companyPhone", req.CompanyPhone},
+		{"website", req.Website},
+		{"domain", req.Domain},
+		{"facebook", req.Facebook},
+		{"linkedinCompanyPage", req.LinkedinCompanyPage},
+	}
+}
+
+// searchLogic is how req joins its flat field filters: OR, or AND by default.
+func searchLogic(req searchRequest) string {
+	if logic := strings.ToUpper(strings.TrimSpace(req.Logic)); logic == "OR" {
+		return logic
+	}
+	return "AND"
+}
+
+// compileSearch builds the WHERE clause of req under its logic, "1" when it
+// has no filters.
+func compileSearch(req searchRequest) (string, []any, error) {
+	where, args, err := buildWhere(req, searchLogic(req))
+	if err != nil {
+		return "", nil, err
+	}
+	if where == "" {
+		where = "1"
+	}
+	return where, args, nil
 }
 
 // buildWhere constructs the WHERE clause for search queries
 // AND logic: ALL filled fields must match (intersection)
 // OR logic: ANY filled field can match (union)
-func buildWhere(req searchRequest, logic string) (string, []any) {
+// A structured Query is always ANDed with the flat fields.
+func buildWhere(req searchRequest, logic string) (string, []any, error) {
+	for field := range req.Match {
+		if _, ok := searchFields[field]; !ok {
+			return "", nil, fmt.Errorf("%w: unknown match field %q", errInvalidQuery, field)
+		}
+	}
 	var parts []string
 	var args []any
-	add := func(expr string, val string, like bool) {
-		if strings.TrimSpace(val) == "" {
-			return
+	var err error
+	for _, f := range req.fieldFilters() {
+		var expr string
+		var a []any
+		if expr, a, err = fieldCondition(f.field, req.Match[f.field], f.val); err != nil {
+			return "", nil, err
+		}
+		if expr != "" {
+			parts = append(parts, expr)
+			args = append(args, a...)
 		}
-		if like {
-			parts = append(parts, expr+" LIKE ?")
-			args = append(args, "%"+strings.ToLower(val)+"%")
-		} else {
-			parts = append(parts, expr+" = ?")
-			args = append(args, val)
-		}
-	}
-	// Use lowercased materialized columns for LIKE to benefit from ngram bloom filter indexes
-	// This provides fast substring matching even on large datasets
-	add("name_lc", req.Name, true)
-	add("email_lc", req.Email, true)
-	add("replaceRegexpAll(phone, '[^0-9]+', '')", onlyDigits(req.Phone), true)
-	add("linkedin_lc", req.Linkedin, true)
-	add("position_lc", req.Position, true)
-	add("company_lc", req.Company, true)
-	add("replaceRegexpAll(company_phone, '[^0-9]+', '')", onlyDigits(req.CompanyPhone), true)
-	add("website_lc", req.Website, true)
-	add("domain_lc", req.Domain, true)
-	add("facebook_lc", req.Facebook, true)
-	add("linkedin_company_page_lc", req.LinkedinCompanyPage, true)
-	if len(parts) == 0 {
-		return "", nil
-	}
-	// Join conditions with AND or OR operator
-	// e.g., AND: (name LIKE ? AND email LIKE ? AND company LIKE ?)
-	// e.g., OR:  (name LIKE ? OR email LIKE ? OR company LIKE ?)
-	return "(" + strings.Join(parts, " "+logic+" ") + ")", args
+	}
+	var where string
+	if len(parts) > 0 {
+		// Join conditions with AND or OR operator
+		// e.g., AND: (name LIKE ? AND email LIKE ? AND company LIKE ?)
+		// e.g., OR:  (name LIKE ? OR email LIKE ? OR company LIKE ?)
+		where = "(" + strings.Join(parts, " "+logic+" ") + ")"
+	}
+	if req.Query != nil {
+		expr, qargs, err := compileQuery(*req.Query)
+		if err != nil {
+			return "", nil, err
+		}
+		if expr != "" {
+			where = andWhere(where, expr)
+			args = append(args, qargs...)
+		}
+	}
+	if len(req.FileIDs) > maxInValues {
+		return "", nil, fmt.Errorf("%w: more than %d fileIds", errInvalidQuery, maxInValues)
+	}
+	if len(req.FileIDs) > 0 {
+		where = andWhere(where, "file_id IN ("+placeholders(len(req.FileIDs))+")")
+		for _, id := range req.FileIDs {
+			args = append(args, id)
+		}
+	}
+	if req.IngestedFrom != "" {
+		from, err := parseIngestedBound(req.IngestedFrom, false)
+		if err != nil {
+			return "", nil, err
+		}
+		where = andWhere(where, "created_at >= toDateTime(?)")
+		args = append(args, from.Unix())
+	}
+	if req.IngestedTo != "" {
+		to, err := parseIngestedBound(req.IngestedTo, true)
+		if err != nil {
+			return "", nil, err
+		}
+		where = andWhere(where, "created_at <= toDateTime(?)")
+		args = append(args, to.Unix())
+	}
+	if len(req.Exclude) > maxQueryConditions {
+		return "", nil, fmt.Errorf("%w: more than %d exclude filters", errInvalidQuery, maxQueryConditions)
+	}
+	excludeConds := 0
+	for _, ex := range req.Exclude {
+		expr, exArgs, err := ex.compile(&excludeConds)
+		if err != nil {
+			return "", nil, err
+		}
+		if expr != "" {
+			where = andWhere(where, expr)
+			args = append(args, exArgs...)
+		}
+	}
+	if tokens := searchTokens(req.Q); len(tokens) > 0 {
+		if len(tokens) > maxSearchTokens {
+			return "", nil, fmt.Errorf("%w: q has more than %d words", errInvalidQuery, maxSearchTokens)
+		}
+		for _, t := range tokens {
+			where = andWhere(where, "hasToken(search_text, ?)")
+			args = append(args, t)
+		}
+	}
+	countries := req.Countries
+	if req.NormalizeCountries {
+		countries = nil
+		for _, v := range req.Countries {
+			countries = append(countries, countrySpellings(v)...)
+		}
+	}
+	for _, f := range []struct {
+		name   string
+		col    string
+		values []string
+	}{
+		{"countries", "country_lc", countries},
+		{"states", "state_lc", req.States},
+		{"emailDomains", "email_domain_lc", emailDomains(req.EmailDomains)},
+		{"seniorities", "seniority", req.Seniorities},
+		{"departments", "department", req.Departments},
+	} {
+		expr, inArgs, err := inCondition(f.name, f.col, f.values)
+		if err != nil {
+			return "", nil, err
+		}
+		if expr != "" {
+			where = andWhere(where, expr)
+			args = append(args, inArgs...)
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(req.EmailType)) {
+	case "":
+	case "work":
+		where = andWhere(where, "email_domain_lc != '' AND is_free_email = 0")
+	case "personal":
+		where = andWhere(where, "is_free_email = 1")
+	default:
+		return "", nil, fmt.Errorf("%w: emailType must be work or personal", errInvalidQuery)
+	}
+	return where, args, nil
+}
+
+// emailDomains strips the "@" users tend to type before a domain.
+func emailDomains(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.TrimPrefix(strings.TrimSpace(v), "@")
+	}
+	return out
+}
+
+// parseIngestedBound parses an IngestedFrom or IngestedTo value. A date
+// names midnight IST, or the last second of that day when it is the end of
+// the range.
+func parseIngestedBound(s string, end bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	d, err := time.ParseInLocation("2006-01-02", s, ist)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: ingested dates must be YYYY-MM-DD or RFC 3339", errInvalidQuery)
+	}
+	if end {
+		d = d.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return d, nil
+}
+
+// maxSearchTokens bounds the words in a free-text q filter.
+const maxSearchTokens = 10
+
+// searchTokens splits free text into the lowercased, de-duplicated tokens
+// idx_search_text indexes. ClickHouse splits on ASCII characters other than
+// letters and digits and keeps non-ASCII characters inside tokens, so
+// "John O'Neil, acme.com" becomes john, o, neil, acme, com.
+func searchTokens(q string) []string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return r < 128 && !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	seen := make(map[string]bool, len(words))
+	tokens := words[:0]
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			tokens = append(tokens, w)
+		}
+	}
+	return tokens
+}
+
+// maxInValues bounds the number of values in a multi-value filter.
+const maxInValues = 500
+
+// inCondition compiles an IN filter over the trimmed, lowercased and
+// de-duplicated values; expr is empty when no values are given.
+func inCondition(name, col string, values []string) (expr string, args []any, err error) {
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		args = append(args, v)
+	}
+	if len(args) == 0 {
+		return "", nil, nil
+	}
+	if len(args) > maxInValues {
+		return "", nil, fmt.Errorf("%w: more than %d %s", errInvalidQuery, maxInValues, name)
+	}
+	return col + " IN (" + placeholders(len(args)) + ")", args, nil
+}
+
+// placeholders returns n comma-separated bind placeholders for an IN list;
+// a slice bound to a single ? is sent as an array instead.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// normList lowercases, de-duplicates and sorts values for cache keys.
+func normList(values []string) string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
+
+// andWhere joins two WHERE fragments with AND, either of which may be empty.
+func andWhere(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + " AND " + b
 }
 
 func onlyDigits(s string) string {
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sortKey is one key of a requested result order, e.g.
+// {"field":"company","dir":"asc"}.
+type sortKey struct {
+	Field string `json:"field"`
+	Dir   string `json:"dir"` // asc (default) or desc
+}
+
+const maxSortKeys = 5
+
+// sortColumns are the fields results can be ordered by and the column each
+// one sorts on. relevance is also accepted; its expression depends on the
+// request (see relevanceExpr).
+var sortColumns = map[string]string{
+	"name":       "name_lc",
+	"company":    "company_lc",
+	"position":   "position_lc",
+	"domain":     "domain_lc",
+	"created_at": "created_at",
+}
+
+// Kinds of ORDER BY terms; they differ in how a cursor stores their value.
+const (
+	keyText = iota
+	keyTime
+	keyID
+	keyScore
+)
+
+// orderKey is one term of the ORDER BY a search runs with.
+type orderKey struct {
+	expr string
+	desc bool
+	kind int
+}
+
+// resultOrder resolves the sort of req into ORDER BY terms. The order always
+// ends with created_at and the contact id so that it is total, which keyset
+// pagination relies on; only identical copies of a row from one upload made
+// before ids existed share an id. With no sort it is relevance DESC when req
+// has flat fields or q to rank by, then created_at DESC, id DESC.
+func resultOrder(req searchRequest) ([]orderKey, error) {
+	keys := req.Sort
+	if len(keys) == 0 && len(matchScores(req)) > 0 {
+		keys = []sortKey{{Field: relevanceSort, Dir: "desc"}}
+	}
+	if len(keys) > maxSortKeys {
+		return nil, fmt.Errorf("%w: more than %d sort keys", errInvalidQuery, maxSortKeys)
+	}
+	var order []orderKey
+	seen := map[string]bool{}
+	for _, k := range keys {
+		field := strings.TrimSpace(k.Field)
+		col, ok := sortColumns[field]
+		if field == relevanceSort {
+			col, ok = relevanceExpr(req), true
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot sort by %q", errInvalidQuery, k.Field)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("%w: %s sorted on twice", errInvalidQuery, field)
+		}
+		seen[field] = true
+		var desc bool
+		switch strings.ToLower(strings.TrimSpace(k.Dir)) {
+		case "", "asc":
+		case "desc":
+			desc = true
+		default:
+			return nil, fmt.Errorf("%w: sort direction must be asc or desc", errInvalidQuery)
+		}
+		kind := keyText
+		switch field {
+		case "created_at":
+			kind = keyTime
+		case relevanceSort:
+			kind = keyScore
+		}
+		order = append(order, orderKey{expr: col, desc: desc, kind: kind})
+	}
+	if !seen["created_at"] {
+		order = append(order, orderKey{expr: "created_at", desc: true, kind: keyTime})
+	}
+	return append(order, orderKey{expr: "id", desc: true, kind: keyID}), nil
+}
+
+// sortSignature normalizes a requested sort for cache keys and cursors, e.g.
+// "company:asc,name:desc". It is empty for the default order.
+func sortSignature(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		dir := strings.ToLower(strings.TrimSpace(k.Dir))
+		if dir == "" {
+			dir = "asc"
+		}
+		parts[i] = strings.TrimSpace(k.Field) + ":" + dir
+	}
+	return strings.Join(parts, ",")
+}
+
+func orderByClause(order []orderKey) string {
+	parts := make([]string, len(order))
+	for i, k := range order {
+		parts[i] = k.expr + " ASC"
+		if k.desc {
+			parts[i] = k.expr + " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// orderSelect lists the ORDER BY terms as extra columns to select, so the
+// last row of a page can be turned into a cursor.
+func orderSelect(order []orderKey) string {
+	parts := make([]string, len(order))
+	for i, k := range order {
+		parts[i] = k.expr
+		if k.kind == keyTime {
+			parts[i] = "toUnixTimestamp(created_at)"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wantsNDJSON reports whether the client asked for newline-delimited JSON,
+// via the Accept header or ?format=ndjson.
+func wantsNDJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "application/x-ndjson") || c.Query("format") == "ndjson"
+}
+
+// writeNDJSONLine writes one line of an NDJSON response.
+func writeNDJSONLine(c *gin.Context, line []byte) {
+	_, _ = c.Writer.Write(line)
+	_, _ = c.Writer.Write([]byte{'\n'})
+}
+
+// searchStream is a search runSearch has prepared for streaming.
+type searchStream struct {
+	dataQuery     string
+	dataArgs      []any
+	countQuery    string
+	countArgs     []any
+	proj          rowProjection
+	order         []orderKey
+	sortSig       string
+	size          int
+	normalizedKey string
+	runKey        *string
+	usageDate     string
+	since         *time.Time
+}
+
+// streamSearch writes a search as NDJSON: one line per row as it is scanned
+// from ClickHouse, then a final {"total","nextCursor","since"} line, with
+// didYouMean when nothing matched. Rows are
+// never held in memory, so no snapshot is logged and the device cache is
+// left alone. Errors after the first line are reported as an {"error"} line.
+func (h *Handlers) streamSearch(c *gin.Context, req searchRequest, s searchStream) {
+	userID := c.GetString("user_id")
+	fingerprint := c.GetString("device_fingerprint")
+	mask, err := h.rowMasker(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ckCtx, ckCancel := context.WithTimeout(c.Request.Context(), requestTimeout(c, 20*time.Second))
+	defer ckCancel()
+	type countResult struct {
+		total uint64
+		err   error
+	}
+	countChan := make(chan countResult, 1)
+	go func() {
+		countCtx, countCancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer countCancel()
+		var total uint64
+		err := h.ck.QueryRow(countCtx, s.countQuery, s.countArgs...).Scan(&total)
+		countChan <- countResult{total: total, err: err}
+	}()
+
+	rows, err := h.ck.Query(ckCtx, s.dataQuery, s.dataArgs...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	last := newCursor(s.sortSig, s.since)
+	lastDest := cursorDest(s.order, &last)
+	// filenames are looked up as new uploads appear; a page spans few
+	files := map[uint64]string{}
+	hl := newHighlighter(req)
+	n := 0
+	for rows.Next() {
+		r, err := scanContact(rows, lastDest...)
+		if err != nil {
+			writeNDJSONLine(c, toJSON(gin.H{"error": err.Error()}))
+			return
+		}
+		r.Score = last.Score
+		if len(hl) > 0 {
+			r.Highlights = hl.ranges(&r)
+		}
+		mask(&r)
+		name, ok := files[r.FileID]
+		if !ok {
+			names, _ := h.sourceFiles(c.Request.Context(), []int64{int64(r.FileID)})
+			name = names[r.FileID]
+			files[r.FileID] = name
+		}
+		r.SourceFile = name
+		if n == 0 {
+			// charge before any row leaves, so a client that disconnects
+			// mid-stream has still paid for what it read
+			h.chargeSearch(context.Background(), userID, s.usageDate)
+		}
+		writeNDJSONLine(c, s.proj.encode(&r))
+		n++
+		if n%100 == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writeNDJSONLine(c, toJSON(gin.H{"error": err.Error()}))
+		return
+	}
+	countRes := <-countChan
+	if countRes.err != nil {
+		writeNDJSONLine(c, toJSON(gin.H{"error": countRes.err.Error()}))
+		return
+	}
+	var next string
+	if n == s.size {
+		next = last.encode()
+	}
+	summary := gin.H{"total": countRes.total, "nextCursor": next, "since": s.since}
+	if countRes.total == 0 {
+		if alt := h.didYouMean(c.Request.Context(), req); alt != nil {
+			summary["didYouMean"] = alt
+		}
+	}
+	writeNDJSONLine(c, toJSON(summary))
+
+	// the body has been sent; log even if the client has gone away since
+	_, _ = h.pg.Exec(context.Background(), `INSERT INTO user_search_logs (user_id, device_fingerprint, ip_address, user_agent, params, normalized_key, total_results, snapshot, query_key)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,NULL,$8)`, userID, fingerprint, c.ClientIP(), c.Request.UserAgent(), toJSON(req), s.normalizedKey, int64(countRes.total), s.runKey)
+	if n == 0 && countRes.total > 0 {
+		// an empty page past the end of the results is charged like Search
+		h.chargeSearch(context.Background(), userID, s.usageDate)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSuggestPrefix bounds the prefix SuggestValues matches on.
+const maxSuggestPrefix = 100
+
+// suggestFields are the fields SuggestValues completes, mapped to the
+// column and its lowercased copy.
+var suggestFields = map[string][2]string{
+	"company":  {"company", "company_lc"},
+	"position": {"position", "position_lc"},
+	"domain":   {"domain", "domain_lc"},
+	"state":    {"state", "state_lc"},
+}
+
+// SuggestValues returns the most frequent values of a field starting with
+// prefix, for typeahead in the search form. It is free of quota and rate
+// limited per user instead.
+func (h *Handlers) SuggestValues(c *gin.Context) {
+	cols, ok := suggestFields[c.Query("field")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "field must be one of company, position, domain, state"})
+		return
+	}
+	prefix := strings.ToLower(strings.TrimSpace(c.Query("prefix")))
+	if prefix == "" || len([]rune(prefix)) > maxSuggestPrefix {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prefix must be 1 to 100 characters"})
+		return
+	}
+	top, ok := topParam(c)
+	if !ok {
+		return
+	}
+
+	ckCtx, ckCancel := context.WithTimeout(c.Request.Context(), requestTimeout(c, 5*time.Second))
+	defer ckCancel()
+	values, err := h.topValues(ckCtx, "contacts", cols[0], cols[1], "startsWith("+cols[1]+", ?)", []any{prefix}, top)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"suggestions": values})
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+//go:embed title_rules.json
+var defaultTitleRules []byte
+
+// titleRule assigns value to positions containing any of patterns as whole
+// words, e.g. "vice president" matches "Vice-President, Sales".
+type titleRule struct {
+	Value    string   `json:"value"`
+	Patterns []string `json:"patterns"`
+}
+
+// titleRules classify a free-text position into seniority and department.
+// The matching pattern with the most words wins, so "vice president" beats
+// "president". On a tie the right-most match wins, since the last words of a
+// title usually name the role ("Partner Marketing Manager" is a manager),
+// and then the earlier rule.
+type titleRules struct {
+	Seniority  []titleRule `json:"seniority"`
+	Department []titleRule `json:"department"`
+}
+
+// loadTitleRules reads the rule table from path, or the built-in
+// title_rules.json when path is empty.
+func loadTitleRules(path string) (*titleRules, error) {
+	b := defaultTitleRules
+	if path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	var r titleRules
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	for _, rules := range [][]titleRule{r.Seniority, r.Department} {
+		for i := range rules {
+			rules[i].Value = strings.ToLower(strings.TrimSpace(rules[i].Value))
+			for j, p := range rules[i].Patterns {
+				rules[i].Patterns[j] = titleWords(p)
+			}
+		}
+	}
+	return &r, nil
+}
+
+// titleWords lowercases s and reduces it to its words separated by single
+// spaces, padded with a space on both ends for whole-word matching.
+func titleWords(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	})
+	return " " + strings.Join(words, " ") + " "
+}
+
+// classify returns the seniority and department of position; either is
+// empty when no rule matches.
+func (t *titleRules) classify(position string) (seniority, department string) {
+	if t == nil || strings.TrimSpace(position) == "" {
+		return "", ""
+	}
+	words := titleWords(position)
+	return matchTitle(t.Seniority, words), matchTitle(t.Department, words)
+}
+
+func matchTitle(rules []titleRule, words string) string {
+	best, bestWords, bestAt := "", 0, -1
+	for _, r := range rules {
+		for _, p := range r.Patterns {
+			// patterns are padded with a space on each end
+			n := strings.Count(p, " ") - 1
+			if n < bestWords {
+				continue
+			}
+			at := strings.LastIndex(words, p)
+			if at >= 0 && (n > bestWords || at > bestAt) {
+				best, bestWords, bestAt = r.Value, n, at
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,44 @@
+package server
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	rules, err := loadTitleRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		position, seniority, department string
+	}{
+		{"", "", ""},
+		{"Chief Executive Officer", "c_level", "executive"},
+		{"Chief Financial Officer", "c_level", "finance"},
+		{"Compliance Officer", "ic", "legal"},
+		{"CTO & Co-Founder", "c_level", "executive"},
+		{"Vice-President, Sales", "vp", "sales"},
+		{"Head of Marketing", "vp", "marketing"},
+		{"Director of Engineering", "director", "engineering"},
+		{"Executive Director", "director", ""},
+		{"Senior Software Engineer", "ic", "engineering"},
+		{"Account Executive", "ic", "sales"},
+		{"Sales Engineer", "ic", "sales"},
+		{"Product Owner", "", "product"},
+		{"Business Owner", "c_level", "executive"},
+		{"Partner Marketing Manager", "manager", "marketing"},
+		{"Managing Partner", "c_level", ""},
+		{"HR Business Partner", "ic", "hr"},
+		{"Chief of Staff", "director", ""},
+		{"Lead Generation Specialist", "ic", ""},
+		{"Sales Team Lead", "manager", "sales"},
+		{"Data Entry Clerk", "ic", ""},
+		{"Data Scientist", "ic", "engineering"},
+		{"Product Marketing Manager", "manager", "marketing"},
+		{"Customer Success Manager", "manager", "customer_success"},
+	}
+	for _, tt := range tests {
+		seniority, department := rules.classify(tt.position)
+		if seniority != tt.seniority || department != tt.department {
+			t.Errorf("classify(%q) = %q, %q; want %q, %q", tt.position, seniority, department, tt.seniority, tt.department)
+		}
+	}
+}
@@ -75,11 +75,15 @@ func (h *Handlers) UploadCSV(c *gin.Context) {
 		return
 	}
 
-	// Kick off ingestion asynchronously with concurrency limit
+	// Kick off ingestion asynchronously with concurrency limit. Alerts run
+	// once the slot is released so they don't hold up the next upload.
 	go func(uploadID int64, path string) {
 		h.ingestSem <- struct{}{}
-		defer func() { <-h.ingestSem }()
-		h.ingestFile(context.Background(), uploadID, path)
+		ok := h.ingestFile(context.Background(), uploadID, path)
+		<-h.ingestSem
+		if ok {
+			h.evaluateAlerts(context.Background(), uploadID)
+		}
 	}(id, dstPath)
 
 	c.JSON(http.StatusOK, gin.H{"file_id": id, "status": "uploaded"})